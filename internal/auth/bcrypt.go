@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DefaultBcryptCost is the cost bcrypt hashes were made with before
+// argon2id became the default.
+const DefaultBcryptCost = bcrypt.DefaultCost
+
+type bcryptScheme struct {
+	cost int
+}
+
+// NewBcrypt keeps verifying hashes from before the switch to argon2id. It
+// can still be selected for new hashes, but bcrypt ignores everything
+// past the 72nd byte of a password.
+func NewBcrypt(cost int) PasswordScheme {
+	return &bcryptScheme{cost: cost}
+}
+
+func (s *bcryptScheme) Name() string { return "bcrypt" }
+
+func (s *bcryptScheme) Owns(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func (s *bcryptScheme) Hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), s.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+func (s *bcryptScheme) Verify(password, encoded string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrPasswordMismatch
+	}
+	return err
+}
+
+func (s *bcryptScheme) UpToDate(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err == nil && cost == s.cost
+}
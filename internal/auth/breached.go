@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// BreachedPasswords answers Have I Been Pwned style range queries: given
+// the first five hex characters of a password's SHA-1, it returns the
+// remaining 35 characters of every breached hash with that prefix and how
+// often each was seen. The full hash never has to leave the caller, so a
+// remote implementation can be swapped in without changing the checks.
+type BreachedPasswords interface {
+	Range(ctx context.Context, prefix string) (map[string]int, error)
+}
+
+// breachPrefixLen is the k-anonymity prefix length HIBP uses.
+const breachPrefixLen = 5
+
+// PasswordBreaches reports how many times password appears in corpus.
+func PasswordBreaches(ctx context.Context, corpus BreachedPasswords, password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+	suffixes, err := corpus.Range(ctx, digest[:breachPrefixLen])
+	if err != nil {
+		return 0, err
+	}
+	return suffixes[digest[breachPrefixLen:]], nil
+}
+
+// BreachRanges reads a local copy of the HIBP range API: one file per
+// prefix, named after it (optionally with .txt, as the official downloader
+// writes them), holding "SUFFIX:COUNT" lines. Files are read on demand, so
+// the corpus never has to fit in memory, and a prefix with no file has no
+// breaches.
+type BreachRanges struct {
+	fsys fs.FS
+}
+
+// OpenBreachRanges serves range queries from the files in dir.
+func OpenBreachRanges(dir string) (*BreachRanges, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	return NewBreachRanges(os.DirFS(dir)), nil
+}
+
+// NewBreachRanges serves range queries from the prefix files in fsys.
+func NewBreachRanges(fsys fs.FS) *BreachRanges {
+	return &BreachRanges{fsys: fsys}
+}
+
+func (b *BreachRanges) Range(ctx context.Context, prefix string) (map[string]int, error) {
+	if len(prefix) != breachPrefixLen {
+		return nil, fmt.Errorf("range prefix must be %d hex characters", breachPrefixLen)
+	}
+	if _, err := hex.DecodeString(prefix + "0"); err != nil {
+		return nil, fmt.Errorf("range prefix must be hex: %w", err)
+	}
+	prefix = strings.ToUpper(prefix)
+
+	file, err := b.fsys.Open(prefix)
+	if errors.Is(err, fs.ErrNotExist) {
+		file, err = b.fsys.Open(prefix + ".txt")
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]int{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	suffixes := make(map[string]int)
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		suffix, countStr, _ := strings.Cut(text, ":")
+		suffix = strings.ToUpper(suffix)
+		if _, err := hex.DecodeString("0" + suffix); err != nil || len(suffix) != 2*sha1.Size-breachPrefixLen {
+			return nil, fmt.Errorf("%s:%d: not a SHA-1 hash suffix", prefix, line)
+		}
+		count := 1
+		if countStr != "" {
+			if count, err = strconv.Atoi(countStr); err != nil {
+				return nil, fmt.Errorf("%s:%d: bad count %q", prefix, line, countStr)
+			}
+		}
+		suffixes[suffix] = count
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return suffixes, nil
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"context"
+	"maps"
+	"testing"
+	"testing/fstest"
+)
+
+func TestBreachRangesRange(t *testing.T) {
+	ranges := NewBreachRanges(fstest.MapFS{
+		"5BAA6":     {Data: []byte("1E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\r\n003D68EB55068C33ACE09247EE4C639306B:3\n\n")},
+		"00000.txt": {Data: []byte("0005AD76BD555C1D6D771DE417A4B87E4B4:10\n")},
+		"BADBA":     {Data: []byte("not-a-hash:1\n")},
+		"C0C0A":     {Data: []byte("0005AD76BD555C1D6D771DE417A4B87E4B4:many\n")},
+	})
+
+	tests := []struct {
+		name    string
+		prefix  string
+		want    map[string]int
+		wantErr bool
+	}{
+		{
+			name:   "prefix file",
+			prefix: "5BAA6",
+			want: map[string]int{
+				"1E4C9B93F3F0682250B6CF8331B7EE68FD8": 9545824,
+				"003D68EB55068C33ACE09247EE4C639306B": 3,
+			},
+		},
+		{
+			name:   "lowercase prefix",
+			prefix: "5baa6",
+			want: map[string]int{
+				"1E4C9B93F3F0682250B6CF8331B7EE68FD8": 9545824,
+				"003D68EB55068C33ACE09247EE4C639306B": 3,
+			},
+		},
+		{
+			name:   "txt extension",
+			prefix: "00000",
+			want:   map[string]int{"0005AD76BD555C1D6D771DE417A4B87E4B4": 10},
+		},
+		{
+			name:   "no file for prefix",
+			prefix: "FFFFF",
+			want:   map[string]int{},
+		},
+		{name: "short prefix", prefix: "5BAA", wantErr: true},
+		{name: "not hex", prefix: "5BAAG", wantErr: true},
+		{name: "path in prefix", prefix: "../5B", wantErr: true},
+		{name: "bad suffix", prefix: "BADBA", wantErr: true},
+		{name: "bad count", prefix: "C0C0A", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ranges.Range(context.Background(), tt.prefix)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Range(%q) = %v, want an error", tt.prefix, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Range(%q): %v", tt.prefix, err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("Range(%q) = %v, want %v", tt.prefix, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPasswordBreaches(t *testing.T) {
+	// SHA-1("password") is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+	ranges := NewBreachRanges(fstest.MapFS{
+		"5BAA6": {Data: []byte("1E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\n")},
+	})
+	for password, want := range map[string]int{"password": 9545824, "correct-horse-battery": 0} {
+		got, err := PasswordBreaches(context.Background(), ranges, password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("PasswordBreaches(%q) = %d, want %d", password, got, want)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package auth
+
+import "errors"
+
+// Each reason Authenticate can reject a token for has its own error so
+// callers can tell them apart with errors.Is.
+var (
+	ErrMalformedToken   = errors.New("malformed token")
+	ErrUnknownKey       = errors.New("token signed with unknown key")
+	ErrInvalidSignature = errors.New("invalid token signature")
+	ErrTokenExpired     = errors.New("token has expired")
+	ErrTokenNotYetValid = errors.New("token is not valid yet")
+	ErrInvalidIssuer    = errors.New("invalid token issuer")
+	ErrInvalidAudience  = errors.New("invalid token audience")
+	ErrInvalidTokenUse  = errors.New("invalid token use")
+	ErrInvalidSubject   = errors.New("invalid user ID in token")
+	ErrInvalidRole      = errors.New("invalid role in token")
+)
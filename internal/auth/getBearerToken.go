@@ -6,16 +6,33 @@ import (
 	"strings"
 )
 
+// ErrNoAuthorization means the request carried no credentials at all.
+var ErrNoAuthorization = errors.New("authorization header not found")
+
 func GetBearerToken(headers http.Header) (string, error) {
+	return authorizationCredentials(headers, "Bearer")
+}
+
+// GetAPIKey reads an "Authorization: ApiKey <key>" header, the scheme
+// server-to-server callers such as payment webhooks use.
+func GetAPIKey(headers http.Header) (string, error) {
+	return authorizationCredentials(headers, "ApiKey")
+}
+
+func authorizationCredentials(headers http.Header, scheme string) (string, error) {
 	authHeader := headers.Get("Authorization")
 	if authHeader == "" {
-		return "", errors.New("authorization header not found")
+		return "", ErrNoAuthorization
 	}
 
 	parts := strings.SplitN(authHeader, " ", 2)
-	if len(parts) != 2 || parts[0] != "Bearer" {
+	if len(parts) != 2 || !strings.EqualFold(parts[0], scheme) {
 		return "", errors.New("invalid authorization header format")
 	}
 
-	return strings.TrimSpace(parts[1]), nil
+	credentials := strings.TrimSpace(parts[1])
+	if credentials == "" {
+		return "", errors.New("invalid authorization header format")
+	}
+	return credentials, nil
 }
@@ -0,0 +1,14 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// HashRefreshToken returns the digest stored in refresh_tokens.token_hash.
+// Refresh tokens are 256 bits of randomness, so a plain SHA-256 is enough;
+// there is nothing to brute force the way there is with passwords.
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,18 @@
+package auth
+
+// JWKS returns the JSON Web Key Set published at /.well-known/jwks.json.
+// Shared HMAC secrets are never included.
+func (ks *KeySet) JWKS() map[string]any {
+	keys := []map[string]string{}
+	for _, key := range ks.verify {
+		jwk := publicJWK(key)
+		if jwk == nil {
+			continue
+		}
+		jwk["kid"] = key.ID
+		jwk["alg"] = key.Method.Alg()
+		jwk["use"] = "sig"
+		keys = append(keys, jwk)
+	}
+	return map[string]any{"keys": keys}
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key is one JWT signing or verification key. Private is nil for keys that
+// are only kept around to verify tokens issued before a rotation.
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.PrivateKey
+	Public  crypto.PublicKey
+}
+
+// KeySet holds the key new tokens are signed with plus every key that is
+// still accepted for verification, indexed by kid.
+type KeySet struct {
+	signing *Key
+	verify  map[string]*Key
+	policy  TokenPolicy
+}
+
+// NewHMACKeySet is the legacy HS256 setup driven by a single shared secret.
+// Unlike the asymmetric keys, kid isn't derived from the key: a hash of the
+// secret in every token header would let anyone holding a token test
+// guesses at it offline. With no kid configured each process picks a
+// random one, so replicas sharing a secret must share a kid too.
+func NewHMACKeySet(secret, kid string) *KeySet {
+	if kid == "" {
+		b := make([]byte, 16)
+		rand.Read(b)
+		kid = base64.RawURLEncoding.EncodeToString(b)
+	}
+	key := &Key{
+		ID:      kid,
+		Method:  jwt.SigningMethodHS256,
+		Private: []byte(secret),
+		Public:  []byte(secret),
+	}
+	return &KeySet{signing: key, verify: map[string]*Key{key.ID: key}, policy: DefaultTokenPolicy}
+}
+
+// LoadKeySet reads a PEM private key to sign with and any number of extra
+// PEM public (or private) keys that are accepted during a rotation window.
+// RSA keys sign with RS256, Ed25519 keys with EdDSA.
+func LoadKeySet(signingPath string, verifyPaths []string) (*KeySet, error) {
+	signing, err := loadKey(signingPath)
+	if err != nil {
+		return nil, err
+	}
+	if signing.Private == nil {
+		return nil, fmt.Errorf("%s: signing key must be a private key", signingPath)
+	}
+
+	ks := &KeySet{signing: signing, verify: map[string]*Key{signing.ID: signing}, policy: DefaultTokenPolicy}
+	for _, path := range verifyPaths {
+		key, err := loadKey(path)
+		if err != nil {
+			return nil, err
+		}
+		ks.verify[key.ID] = key
+	}
+	return ks, nil
+}
+
+func loadKey(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block found", path)
+	}
+
+	var parsed any
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	key := &Key{}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Private, key.Public = k, &k.PublicKey
+	case ed25519.PrivateKey:
+		key.Private, key.Public = k, k.Public()
+	case *rsa.PublicKey, ed25519.PublicKey:
+		key.Public = k
+	default:
+		return nil, fmt.Errorf("%s: only RSA and Ed25519 keys are supported", path)
+	}
+
+	switch pub := key.Public.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("%s: RSA keys must be at least 2048 bits", path)
+		}
+		key.Method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+	}
+	key.ID = thumbprint(publicJWK(key))
+	return key, nil
+}
+
+// keyFor picks the verification key for a parsed token. Tokens minted
+// before kids existed carry none; those are only accepted by the HS256
+// setup they were issued under.
+func (ks *KeySet) keyFor(token *jwt.Token) (*Key, error) {
+	kid, _ := token.Header["kid"].(string)
+	key := ks.verify[kid]
+	if kid == "" {
+		if _, ok := ks.signing.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("token has no kid")
+		}
+		key = ks.signing
+	}
+	if key == nil {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key, nil
+}
+
+// publicJWK returns the RFC 7517 members that describe key's public half.
+func publicJWK(key *Key) map[string]string {
+	switch pub := key.Public.(type) {
+	case *rsa.PublicKey:
+		return map[string]string{
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			"kty": "RSA",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		}
+	case ed25519.PublicKey:
+		return map[string]string{
+			"crv": "Ed25519",
+			"kty": "OKP",
+			"x":   base64.RawURLEncoding.EncodeToString(pub),
+		}
+	}
+	return nil
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint used as the kid.
+// encoding/json sorts map keys, which is exactly the canonical form.
+func thumbprint(members map[string]string) string {
+	canonical, _ := json.Marshal(members)
+	sum := sha256.Sum256(canonical)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -7,15 +7,40 @@ import (
 	"github.com/google/uuid"
 )
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	claims := &jwt.RegisteredClaims{
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-		Issuer:    "Chirpy",
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		Subject:   userID.String(),
+// Claims is the JWT payload: the registered claims plus what the token
+// may be used for and the role of the user it was issued to.
+type Claims struct {
+	jwt.RegisteredClaims
+	TokenUse string `json:"token_use"`
+	Role     Role   `json:"role,omitempty"`
+}
+
+// MakeJWT signs an access token with the current signing key and stamps
+// its kid into the header. The role is a snapshot: a promotion or demotion
+// only shows up in tokens minted afterwards.
+func (ks *KeySet) MakeJWT(userID uuid.UUID, role Role, expiresIn time.Duration) (string, error) {
+	return ks.makeToken(userID, role, TokenUseAccess, expiresIn)
+}
+
+func (ks *KeySet) makeToken(userID uuid.UUID, role Role, use string, expiresIn time.Duration) (string, error) {
+	now := time.Now().UTC()
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+			Issuer:    ks.policy.Issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Subject:   userID.String(),
+		},
+		TokenUse: use,
+		Role:     role,
+	}
+	if ks.policy.Audience != "" {
+		claims.Audience = jwt.ClaimStrings{ks.policy.Audience}
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	strtoken, err := token.SignedString([]byte(tokenSecret))
+	token := jwt.NewWithClaims(ks.signing.Method, claims)
+	token.Header["kid"] = ks.signing.ID
+	strtoken, err := token.SignedString(ks.signing.Private)
 	return strtoken, err
 
 }
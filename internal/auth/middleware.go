@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"httpserv/internal/logging"
+	"httpserv/internal/problem"
+
+	"github.com/google/uuid"
+)
+
+type userIDKey struct{}
+type roleKey struct{}
+
+// WithUserID returns a copy of ctx carrying the authenticated user's ID.
+func WithUserID(ctx context.Context, userID uuid.UUID) context.Context {
+	return context.WithValue(ctx, userIDKey{}, userID)
+}
+
+// UserIDFromContext returns the user ID stored by Middleware, if any.
+func UserIDFromContext(ctx context.Context) (uuid.UUID, bool) {
+	userID, ok := ctx.Value(userIDKey{}).(uuid.UUID)
+	return userID, ok
+}
+
+// WithRole returns a copy of ctx carrying the authenticated user's role.
+func WithRole(ctx context.Context, role Role) context.Context {
+	return context.WithValue(ctx, roleKey{}, role)
+}
+
+// RoleFromContext returns the role stored by Middleware, if any.
+func RoleFromContext(ctx context.Context) (Role, bool) {
+	role, ok := ctx.Value(roleKey{}).(Role)
+	return role, ok
+}
+
+// Middleware validates the bearer access token once and puts the user ID
+// and role into the request context for the wrapped handler.
+func Middleware(keys *KeySet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, err := GetBearerToken(r.Header)
+			if err != nil {
+				WriteUnauthorized(w, r, ChallengeCode(err), err.Error())
+				return
+			}
+			userID, role, err := keys.Authenticate(token)
+			if err != nil {
+				WriteUnauthorized(w, r, "invalid_token", err.Error())
+				return
+			}
+			logging.SetUserID(r.Context(), userID.String())
+			ctx := WithRole(WithUserID(r.Context(), userID), role)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequireRole rejects callers whose role is below min with a 403. It reads
+// the role Middleware stored, so it must be wrapped inside it.
+func RequireRole(min Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role, ok := RoleFromContext(r.Context())
+			if !ok {
+				WriteUnauthorized(w, r, "invalid_token", "no authenticated user")
+				return
+			}
+			if !role.AtLeast(min) {
+				problem.Write(w, r, http.StatusForbidden, problem.Forbidden, "requires the "+string(min)+" role")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireToken admits only requests carrying secret as their bearer token,
+// for machine callers such as a metrics scraper that have no user account.
+func RequireToken(secret string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, err := GetBearerToken(r.Header)
+			if err != nil {
+				WriteUnauthorized(w, r, ChallengeCode(err), err.Error())
+				return
+			}
+			if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+				WriteUnauthorized(w, r, "invalid_token", "invalid token")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// WriteUnauthorized sends the 401 every authenticated route shares, with a
+// WWW-Authenticate challenge as described in RFC 6750. An empty code sends
+// the bare challenge, which is what a request without credentials gets.
+func WriteUnauthorized(w http.ResponseWriter, r *http.Request, code, description string) {
+	challenge := `Bearer realm="chirpy"`
+	if code != "" {
+		challenge += `, error="` + code + `"`
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	problem.Write(w, r, http.StatusUnauthorized, problem.Unauthorized, description)
+}
+
+// ChallengeCode is the RFC 6750 error code for a GetBearerToken failure:
+// none when no credentials were sent (section 3.1), invalid_request when
+// the header is malformed.
+func ChallengeCode(err error) string {
+	if errors.Is(err, ErrNoAuthorization) {
+		return ""
+	}
+	return "invalid_request"
+}
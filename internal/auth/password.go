@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"runtime"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrPasswordMismatch is returned when a password doesn't match its hash.
+var ErrPasswordMismatch = errors.New("password does not match")
+
+// PasswordScheme is one password hashing algorithm. Encoded hashes carry
+// their own parameters, so a scheme can verify hashes made with settings
+// other than its current ones.
+type PasswordScheme interface {
+	// Name is the identifier used in config, e.g. "argon2id".
+	Name() string
+	// Owns reports whether encoded was produced by this scheme.
+	Owns(encoded string) bool
+	Hash(password string) (string, error)
+	// Verify returns ErrPasswordMismatch for a wrong password and another
+	// error only if encoded can't be parsed.
+	Verify(password, encoded string) error
+	// UpToDate reports whether encoded uses the scheme's current parameters.
+	UpToDate(encoded string) bool
+}
+
+// PasswordHasher hashes new passwords with one scheme and verifies stored
+// hashes with whichever registered scheme made them, so the algorithm or
+// its cost can change without invalidating existing accounts.
+//
+// Every check runs every scheme once, the owning one against the real hash
+// and the others against a dummy, so how long a login takes doesn't tell
+// which scheme an account uses or whether it exists at all. Hashing is
+// memory hungry, so at most GOMAXPROCS hashes run at once; the rest wait
+// their turn or give up when their request does.
+type PasswordHasher struct {
+	current PasswordScheme
+	schemes []PasswordScheme
+	dummies []string // by index into schemes
+	sem     chan struct{}
+}
+
+// NewPasswordHasher hashes with current and also verifies with others.
+func NewPasswordHasher(current PasswordScheme, others ...PasswordScheme) (*PasswordHasher, error) {
+	h := &PasswordHasher{
+		current: current,
+		schemes: append([]PasswordScheme{current}, others...),
+		sem:     make(chan struct{}, runtime.GOMAXPROCS(0)),
+	}
+
+	// hashes of a random password nobody knows, for the schemes that don't
+	// own the hash being checked
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	for _, scheme := range h.schemes {
+		dummy, err := scheme.Hash(hex.EncodeToString(secret))
+		if err != nil {
+			return nil, err
+		}
+		h.dummies = append(h.dummies, dummy)
+	}
+	return h, nil
+}
+
+func (h *PasswordHasher) Hash(ctx context.Context, password string) (string, error) {
+	ctx, span := otel.Tracer("httpserv/auth").Start(ctx, "password.Hash")
+	defer span.End()
+	span.SetAttributes(attribute.String("password.scheme", h.current.Name()))
+
+	if err := h.acquire(ctx); err != nil {
+		return "", err
+	}
+	defer h.release()
+	return h.current.Hash(password)
+}
+
+func (h *PasswordHasher) Check(ctx context.Context, password, encoded string) error {
+	owner := h.schemeFor(encoded)
+	if owner < 0 {
+		// accounts still holding a placeholder like 'unset' must take as
+		// long as any other failure
+		if err := h.verify(ctx, password, -1, ""); err != nil {
+			return err
+		}
+		return errors.New("unrecognised password hash format")
+	}
+
+	ctx, span := otel.Tracer("httpserv/auth").Start(ctx, "password.Verify")
+	defer span.End()
+	span.SetAttributes(attribute.String("password.scheme", h.schemes[owner].Name()))
+
+	return h.verify(ctx, password, owner, encoded)
+}
+
+// CheckNoUser does the same work as Check when there is no account to
+// check against, so a login for an unknown email takes as long as one with
+// a wrong password. It always fails.
+func (h *PasswordHasher) CheckNoUser(ctx context.Context, password string) error {
+	ctx, span := otel.Tracer("httpserv/auth").Start(ctx, "password.Verify")
+	defer span.End()
+
+	if err := h.verify(ctx, password, -1, ""); err != nil {
+		return err
+	}
+	return ErrPasswordMismatch
+}
+
+// verify checks password against encoded with the scheme at index owner,
+// and against the dummy with every other scheme. With owner -1 only
+// dummies are checked and the result is nil unless ctx ended.
+func (h *PasswordHasher) verify(ctx context.Context, password string, owner int, encoded string) error {
+	if err := h.acquire(ctx); err != nil {
+		return err
+	}
+	defer h.release()
+
+	var result error
+	for i, scheme := range h.schemes {
+		if i == owner {
+			result = scheme.Verify(password, encoded)
+			continue
+		}
+		scheme.Verify(password, h.dummies[i])
+	}
+	return result
+}
+
+// acquire waits for a free hashing slot, or returns ctx's error if the
+// caller stops waiting first.
+func (h *PasswordHasher) acquire(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case h.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (h *PasswordHasher) release() {
+	<-h.sem
+}
+
+// NeedsRehash reports whether encoded should be replaced by a fresh Hash,
+// because it was made by an older scheme or with older parameters.
+func (h *PasswordHasher) NeedsRehash(encoded string) bool {
+	return !h.current.Owns(encoded) || !h.current.UpToDate(encoded)
+}
+
+// schemeFor returns the index of the scheme that made encoded, or -1.
+func (h *PasswordHasher) schemeFor(encoded string) int {
+	for i, s := range h.schemes {
+		if s.Owns(encoded) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"httpserv/internal/problem"
+)
+
+// Password policy violation codes, reported as problem.FieldError codes on
+// the "password" field.
+const (
+	PasswordTooShort      = "too_short"
+	PasswordTooLong       = "too_long"
+	PasswordContainsEmail = "contains_email"
+	PasswordBreached      = "breached"
+)
+
+// BcryptMaxBytes is where bcrypt silently stops reading a password.
+const BcryptMaxBytes = 72
+
+// PasswordPolicy is what a new password must satisfy. MinLength counts
+// characters; MaxBytes counts bytes, since that is what hashers care about.
+// Breached is optional.
+type PasswordPolicy struct {
+	MinLength int
+	MaxBytes  int
+	Breached  BreachedPasswords
+}
+
+// Check returns every rule password breaks, so the client can fix them all
+// at once. The error is only for a failed breach lookup.
+func (p PasswordPolicy) Check(ctx context.Context, password, email string) ([]problem.FieldError, error) {
+	var errs []problem.FieldError
+	fail := func(code, message string) {
+		errs = append(errs, problem.FieldError{Field: "password", Code: code, Message: message})
+	}
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		fail(PasswordTooShort, "password must be at least "+strconv.Itoa(p.MinLength)+" characters")
+	}
+	if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		fail(PasswordTooLong, "password must be at most "+strconv.Itoa(p.MaxBytes)+" bytes")
+	}
+	if containsEmail(password, email) {
+		fail(PasswordContainsEmail, "password must not contain your email address")
+	}
+
+	if p.Breached != nil && password != "" {
+		n, err := PasswordBreaches(ctx, p.Breached, password)
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			fail(PasswordBreached, "password has appeared in a data breach, choose another")
+		}
+	}
+	return errs, nil
+}
+
+// containsEmail catches the whole address and its local part, ignoring
+// case. Local parts under three characters would match too much.
+func containsEmail(password, email string) bool {
+	password = strings.ToLower(password)
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return false
+	}
+	if strings.Contains(password, email) {
+		return true
+	}
+	local, _, _ := strings.Cut(email, "@")
+	return len(local) >= 3 && strings.Contains(password, local)
+}
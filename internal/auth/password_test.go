@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// cheapArgon2 keeps the tests fast; the format and checks don't depend on
+// the cost.
+var cheapArgon2 = Argon2Params{Memory: 64, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32}
+
+func TestArgon2idRoundTrip(t *testing.T) {
+	scheme := NewArgon2id(cheapArgon2)
+	encoded, err := scheme.Hash("correct-horse-battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("encoded = %q, want the PHC argon2id format", encoded)
+	}
+	if !scheme.Owns(encoded) {
+		t.Errorf("Owns(%q) = false", encoded)
+	}
+	if err := scheme.Verify("correct-horse-battery", encoded); err != nil {
+		t.Errorf("Verify with the right password: %v", err)
+	}
+	if err := scheme.Verify("wrong-horse-battery", encoded); !errors.Is(err, ErrPasswordMismatch) {
+		t.Errorf("Verify with a wrong password = %v, want ErrPasswordMismatch", err)
+	}
+
+	again, err := scheme.Hash("correct-horse-battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == encoded {
+		t.Error("two hashes of one password are equal; the salt isn't random")
+	}
+}
+
+func TestArgon2idMalformed(t *testing.T) {
+	scheme := NewArgon2id(cheapArgon2)
+	const salt, key = "c2FsdHNhbHRzYWx0c2FsdA", "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U"
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{"too few fields", "$argon2id$v=19$m=64,t=1,p=1$" + salt},
+		{"other variant", "$argon2i$v=19$m=64,t=1,p=1$" + salt + "$" + key},
+		{"old version", "$argon2id$v=16$m=64,t=1,p=1$" + salt + "$" + key},
+		{"no params", "$argon2id$v=19$$" + salt + "$" + key},
+		{"zero time", "$argon2id$v=19$m=64,t=0,p=1$" + salt + "$" + key},
+		{"zero threads", "$argon2id$v=19$m=64,t=1,p=0$" + salt + "$" + key},
+		{"memory below 8 per thread", "$argon2id$v=19$m=15,t=1,p=2$" + salt + "$" + key},
+		{"bad salt", "$argon2id$v=19$m=64,t=1,p=1$!!$" + key},
+		{"empty key", "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := scheme.Verify("password", tt.encoded); !errors.Is(err, errMalformedArgon2) {
+				t.Errorf("Verify = %v, want errMalformedArgon2", err)
+			}
+			if scheme.UpToDate(tt.encoded) {
+				t.Error("UpToDate = true for a malformed hash")
+			}
+		})
+	}
+}
+
+func TestPasswordHasherRehash(t *testing.T) {
+	current := NewArgon2id(cheapArgon2)
+	older := cheapArgon2
+	older.Time = 2
+	legacy := NewBcrypt(bcrypt.MinCost)
+
+	h, err := NewPasswordHasher(current, legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashWith := func(s PasswordScheme) string {
+		t.Helper()
+		encoded, err := s.Hash("correct-horse-battery")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return encoded
+	}
+
+	tests := []struct {
+		name         string
+		encoded      string
+		needsRehash  bool
+		wantUpToDate bool
+	}{
+		{"current parameters", hashWith(current), false, true},
+		{"older argon2id parameters", hashWith(NewArgon2id(older)), true, false},
+		{"bcrypt", hashWith(legacy), true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := h.NeedsRehash(tt.encoded); got != tt.needsRehash {
+				t.Errorf("NeedsRehash = %v, want %v", got, tt.needsRehash)
+			}
+			if got := current.UpToDate(tt.encoded); got != tt.wantUpToDate {
+				t.Errorf("UpToDate = %v, want %v", got, tt.wantUpToDate)
+			}
+			// whatever made it, the hash still verifies
+			if err := h.Check(context.Background(), "correct-horse-battery", tt.encoded); err != nil {
+				t.Errorf("Check with the right password: %v", err)
+			}
+			if err := h.Check(context.Background(), "wrong-horse-battery", tt.encoded); !errors.Is(err, ErrPasswordMismatch) {
+				t.Errorf("Check with a wrong password = %v, want ErrPasswordMismatch", err)
+			}
+		})
+	}
+}
+
+func TestPasswordHasherBcryptCurrent(t *testing.T) {
+	// switching back to bcrypt still verifies the argon2id hashes made since
+	argon := NewArgon2id(cheapArgon2)
+	h, err := NewPasswordHasher(NewBcrypt(bcrypt.MinCost), argon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := argon.Hash("correct-horse-battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Check(context.Background(), "correct-horse-battery", encoded); err != nil {
+		t.Errorf("Check: %v", err)
+	}
+	if !h.NeedsRehash(encoded) {
+		t.Error("NeedsRehash = false for an argon2id hash with bcrypt current")
+	}
+	fresh, err := h.Hash(context.Background(), "correct-horse-battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(fresh, "$2a$") {
+		t.Errorf("Hash = %q, want a bcrypt hash", fresh)
+	}
+}
+
+func TestPasswordHasherNoUser(t *testing.T) {
+	h, err := NewPasswordHasher(NewArgon2id(cheapArgon2), NewBcrypt(bcrypt.MinCost))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.CheckNoUser(context.Background(), "correct-horse-battery"); !errors.Is(err, ErrPasswordMismatch) {
+		t.Errorf("CheckNoUser = %v, want ErrPasswordMismatch", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := h.CheckNoUser(ctx, "correct-horse-battery"); !errors.Is(err, context.Canceled) {
+		t.Errorf("CheckNoUser after cancel = %v, want context.Canceled", err)
+	}
+	if _, err := h.Hash(ctx, "correct-horse-battery"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Hash after cancel = %v, want context.Canceled", err)
+	}
+}
+
+func TestPasswordHasherUnrecognisedHash(t *testing.T) {
+	h, err := NewPasswordHasher(NewArgon2id(cheapArgon2), NewBcrypt(bcrypt.MinCost))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the schema default for users who never set a password
+	err = h.Check(context.Background(), "unset", "unset")
+	if err == nil || errors.Is(err, ErrPasswordMismatch) {
+		t.Errorf("Check = %v, want an unrecognised format error", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := h.Check(ctx, "unset", "unset"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Check after cancel = %v, want context.Canceled, since it hashes like any other check", err)
+	}
+}
@@ -0,0 +1,30 @@
+package auth
+
+import "time"
+
+// Values for the token_use claim. Only access tokens are JWTs today, but
+// checking the claim stops a token minted for some other purpose from
+// being replayed as one.
+const (
+	TokenUseAccess = "access"
+)
+
+// TokenPolicy is what tokens are stamped with when minted and what they
+// must match when validated.
+type TokenPolicy struct {
+	Issuer   string
+	Audience string
+	Leeway   time.Duration
+}
+
+// DefaultTokenPolicy is applied to every new KeySet.
+var DefaultTokenPolicy = TokenPolicy{
+	Issuer:   "Chirpy",
+	Audience: "chirpy",
+	Leeway:   30 * time.Second,
+}
+
+// SetPolicy replaces the issuer, audience and leeway used by ks.
+func (ks *KeySet) SetPolicy(policy TokenPolicy) {
+	ks.policy = policy
+}
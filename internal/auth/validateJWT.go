@@ -3,38 +3,75 @@ package auth
 import (
 	"errors"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claims := &jwt.RegisteredClaims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		// Ensure the signing method is HMAC
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(tokenSecret), nil
-	})
+// Authenticate checks an access token against whichever key its kid names
+// and against the KeySet's TokenPolicy, returning the user and role it was
+// issued to. Tokens issued before roles existed have none and count as
+// RoleUser.
+func (ks *KeySet) Authenticate(tokenString string) (uuid.UUID, Role, error) {
+	return ks.validateToken(tokenString, TokenUseAccess)
+}
 
-	if err != nil {
-		return uuid.UUID{}, err
+func (ks *KeySet) validateToken(tokenString, use string) (uuid.UUID, Role, error) {
+	// the library only verifies the signature here; claims are checked
+	// below so every failure maps onto exactly one of our errors
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		key, err := ks.keyFor(token)
+		if err != nil {
+			return nil, err
+		}
+		return key.Public, nil
+	}, jwt.WithoutClaimsValidation())
+	switch {
+	case err == nil:
+	case errors.Is(err, jwt.ErrTokenUnverifiable):
+		return uuid.UUID{}, "", fmt.Errorf("%w: %v", ErrUnknownKey, err)
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid):
+		return uuid.UUID{}, "", ErrInvalidSignature
+	default:
+		return uuid.UUID{}, "", fmt.Errorf("%w: %v", ErrMalformedToken, err)
 	}
 
-	if !token.Valid {
-		return uuid.UUID{}, errors.New("invalid token")
+	now := time.Now()
+	leeway := ks.policy.Leeway
+	if claims.ExpiresAt == nil || !now.Before(claims.ExpiresAt.Add(leeway)) {
+		return uuid.UUID{}, "", ErrTokenExpired
 	}
-
-	if claims.ExpiresAt != nil && time.Now().After(claims.ExpiresAt.Time) {
-		return uuid.UUID{}, errors.New("token has expired")
+	if claims.NotBefore != nil && now.Add(leeway).Before(claims.NotBefore.Time) {
+		return uuid.UUID{}, "", ErrTokenNotYetValid
+	}
+	if claims.IssuedAt != nil && now.Add(leeway).Before(claims.IssuedAt.Time) {
+		return uuid.UUID{}, "", ErrTokenNotYetValid
+	}
+	if claims.Issuer != ks.policy.Issuer {
+		return uuid.UUID{}, "", fmt.Errorf("%w: %q", ErrInvalidIssuer, claims.Issuer)
+	}
+	if ks.policy.Audience != "" && !slices.Contains(claims.Audience, ks.policy.Audience) {
+		return uuid.UUID{}, "", fmt.Errorf("%w: %q", ErrInvalidAudience, claims.Audience)
+	}
+	if claims.TokenUse != use {
+		return uuid.UUID{}, "", fmt.Errorf("%w: %q", ErrInvalidTokenUse, claims.TokenUse)
 	}
 
 	userID, err := uuid.Parse(claims.Subject) // https://pkg.go.dev/github.com/google/uuid#Parse
 	if err != nil {
-		return uuid.UUID{}, errors.New("invalid user ID in token")
+		return uuid.UUID{}, "", ErrInvalidSubject
+	}
+
+	role := RoleUser
+	if claims.Role != "" {
+		var ok bool
+		if role, ok = ParseRole(string(claims.Role)); !ok {
+			return uuid.UUID{}, "", fmt.Errorf("%w: %q", ErrInvalidRole, claims.Role)
+		}
 	}
 
-	return userID, nil
+	return userID, role, nil
 }
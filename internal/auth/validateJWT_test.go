@@ -0,0 +1,266 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func TestValidateToken(t *testing.T) {
+	ks := NewHMACKeySet(testSecret, "")
+	userID := uuid.New()
+	now := time.Now()
+	leeway := DefaultTokenPolicy.Leeway
+
+	// valid returns claims that pass every check; each case breaks one
+	valid := func() *Claims {
+		return &Claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    DefaultTokenPolicy.Issuer,
+				Subject:   userID.String(),
+				Audience:  jwt.ClaimStrings{DefaultTokenPolicy.Audience},
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+				NotBefore: jwt.NewNumericDate(now),
+				IssuedAt:  jwt.NewNumericDate(now),
+			},
+			TokenUse: TokenUseAccess,
+			Role:     RoleModerator,
+		}
+	}
+	sign := func(t *testing.T, claims *Claims, method jwt.SigningMethod, kid string) string {
+		t.Helper()
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		s, err := token.SignedString([]byte(testSecret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	signed := func(t *testing.T, edit func(*Claims)) string {
+		t.Helper()
+		claims := valid()
+		edit(claims)
+		return sign(t, claims, jwt.SigningMethodHS256, ks.signing.ID)
+	}
+
+	tests := []struct {
+		name     string
+		token    func(t *testing.T) string
+		wantErr  error
+		wantRole Role
+	}{
+		{
+			name:     "valid",
+			token:    func(t *testing.T) string { return signed(t, func(*Claims) {}) },
+			wantRole: RoleModerator,
+		},
+		{
+			name: "no role claim means user",
+			token: func(t *testing.T) string {
+				return signed(t, func(c *Claims) { c.Role = "" })
+			},
+			wantRole: RoleUser,
+		},
+		{
+			name: "expired",
+			token: func(t *testing.T) string {
+				return signed(t, func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-leeway - time.Minute)) })
+			},
+			wantErr: ErrTokenExpired,
+		},
+		{
+			name: "expired within leeway",
+			token: func(t *testing.T) string {
+				return signed(t, func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-leeway / 2)) })
+			},
+			wantRole: RoleModerator,
+		},
+		{
+			name: "missing exp",
+			token: func(t *testing.T) string {
+				return signed(t, func(c *Claims) { c.ExpiresAt = nil })
+			},
+			wantErr: ErrTokenExpired,
+		},
+		{
+			name: "nbf in the future",
+			token: func(t *testing.T) string {
+				return signed(t, func(c *Claims) { c.NotBefore = jwt.NewNumericDate(now.Add(leeway + time.Minute)) })
+			},
+			wantErr: ErrTokenNotYetValid,
+		},
+		{
+			name: "nbf within leeway",
+			token: func(t *testing.T) string {
+				return signed(t, func(c *Claims) { c.NotBefore = jwt.NewNumericDate(now.Add(leeway / 2)) })
+			},
+			wantRole: RoleModerator,
+		},
+		{
+			name: "iat in the future",
+			token: func(t *testing.T) string {
+				return signed(t, func(c *Claims) { c.IssuedAt = jwt.NewNumericDate(now.Add(leeway + time.Minute)) })
+			},
+			wantErr: ErrTokenNotYetValid,
+		},
+		{
+			name: "iat within leeway",
+			token: func(t *testing.T) string {
+				return signed(t, func(c *Claims) { c.IssuedAt = jwt.NewNumericDate(now.Add(leeway / 2)) })
+			},
+			wantRole: RoleModerator,
+		},
+		{
+			name: "wrong issuer",
+			token: func(t *testing.T) string {
+				return signed(t, func(c *Claims) { c.Issuer = "someone-else" })
+			},
+			wantErr: ErrInvalidIssuer,
+		},
+		{
+			name: "wrong audience",
+			token: func(t *testing.T) string {
+				return signed(t, func(c *Claims) { c.Audience = jwt.ClaimStrings{"other-service"} })
+			},
+			wantErr: ErrInvalidAudience,
+		},
+		{
+			name: "missing audience",
+			token: func(t *testing.T) string {
+				return signed(t, func(c *Claims) { c.Audience = nil })
+			},
+			wantErr: ErrInvalidAudience,
+		},
+		{
+			name: "wrong token_use",
+			token: func(t *testing.T) string {
+				return signed(t, func(c *Claims) { c.TokenUse = "refresh" })
+			},
+			wantErr: ErrInvalidTokenUse,
+		},
+		{
+			name: "unknown role",
+			token: func(t *testing.T) string {
+				return signed(t, func(c *Claims) { c.Role = "superuser" })
+			},
+			wantErr: ErrInvalidRole,
+		},
+		{
+			name: "subject not a uuid",
+			token: func(t *testing.T) string {
+				return signed(t, func(c *Claims) { c.Subject = "42" })
+			},
+			wantErr: ErrInvalidSubject,
+		},
+		{
+			name: "unknown kid",
+			token: func(t *testing.T) string {
+				return sign(t, valid(), jwt.SigningMethodHS256, "not-a-known-kid")
+			},
+			wantErr: ErrUnknownKey,
+		},
+		{
+			name: "alg does not match key",
+			token: func(t *testing.T) string {
+				return sign(t, valid(), jwt.SigningMethodHS512, ks.signing.ID)
+			},
+			wantErr: ErrUnknownKey,
+		},
+		{
+			name: "alg none",
+			token: func(t *testing.T) string {
+				token := jwt.NewWithClaims(jwt.SigningMethodNone, valid())
+				token.Header["kid"] = ks.signing.ID
+				s, err := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return s
+			},
+			wantErr: ErrUnknownKey,
+		},
+		{
+			name: "bad signature",
+			token: func(t *testing.T) string {
+				s := signed(t, func(*Claims) {})
+				i := strings.LastIndexByte(s, '.')
+				return s[:i+1] + strings.Repeat("A", len(s)-i-1)
+			},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "malformed",
+			token:   func(t *testing.T) string { return "not.a.jwt" },
+			wantErr: ErrMalformedToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotID, gotRole, err := ks.Authenticate(tt.token(t))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if gotID != userID {
+				t.Errorf("user ID = %v, want %v", gotID, userID)
+			}
+			if gotRole != tt.wantRole {
+				t.Errorf("role = %q, want %q", gotRole, tt.wantRole)
+			}
+		})
+	}
+}
+
+func TestValidateTokenRoundTrip(t *testing.T) {
+	ks := NewHMACKeySet(testSecret, "")
+	userID := uuid.New()
+	token, err := ks.MakeJWT(userID, RoleAdmin, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotID, gotRole, err := ks.Authenticate(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotID != userID || gotRole != RoleAdmin {
+		t.Errorf("got (%v, %q), want (%v, %q)", gotID, gotRole, userID, RoleAdmin)
+	}
+}
+
+func TestHMACKeyID(t *testing.T) {
+	kid := func(ks *KeySet) string {
+		token, err := ks.MakeJWT(uuid.New(), RoleUser, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := parsed.Header["kid"].(string)
+		return id
+	}
+
+	if got := kid(NewHMACKeySet(testSecret, "2026-10")); got != "2026-10" {
+		t.Errorf("configured kid = %q, want %q", got, "2026-10")
+	}
+	a, b := kid(NewHMACKeySet(testSecret, "")), kid(NewHMACKeySet(testSecret, ""))
+	if a == "" || a == b {
+		t.Errorf("random kids %q and %q should be distinct and non-empty", a, b)
+	}
+}
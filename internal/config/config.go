@@ -0,0 +1,434 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is everything the server needs to start. Values are layered:
+// defaults, then the optional YAML file, then the environment (including
+// .env), then command line flags.
+type Config struct {
+	DBURL    string `yaml:"db_url"`
+	Platform string `yaml:"platform"`
+	// MigrateOnStart applies pending migrations before listening.
+	MigrateOnStart bool     `yaml:"migrate_on_start"`
+	Server         Server   `yaml:"server"`
+	JWT            JWT      `yaml:"jwt"`
+	Log            Log      `yaml:"log"`
+	Tracing        Tracing  `yaml:"tracing"`
+	Static         Static   `yaml:"static"`
+	Polka          Polka    `yaml:"polka"`
+	Metrics        Metrics  `yaml:"metrics"`
+	Content        Content  `yaml:"content"`
+	Login          Login    `yaml:"login"`
+	Password       Password `yaml:"password"`
+}
+
+type Server struct {
+	Addr              string        `yaml:"addr"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout"`
+	// DrainDelay keeps serving with readiness failing before shutdown
+	// starts, giving load balancers time to stop sending traffic.
+	DrainDelay     time.Duration `yaml:"drain_delay"`
+	MaxHeaderBytes int           `yaml:"max_header_bytes"`
+	// TrustedProxies are the addresses or CIDRs of load balancers allowed
+	// to name the client in X-Forwarded-For. Until it is set the per-IP
+	// login lockout is off, since behind a proxy every client would share
+	// the proxy's address.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+type JWT struct {
+	// Secret is the HS256 key, only used when no SigningKey is set.
+	Secret string `yaml:"secret"`
+	// SecretKeyID is the kid tokens signed with Secret carry. Every
+	// replica needs the same one; left empty each process picks its own.
+	SecretKeyID string        `yaml:"secret_key_id"`
+	SigningKey  string        `yaml:"signing_key"`
+	VerifyKeys  []string      `yaml:"verify_keys"`
+	Issuer      string        `yaml:"issuer"`
+	Audience    string        `yaml:"audience"`
+	Leeway      time.Duration `yaml:"leeway"`
+}
+
+type Log struct {
+	// Level is one of debug, info, warn or error.
+	Level string `yaml:"level"`
+}
+
+type Tracing struct {
+	// Exporter is none, stdout or otlp. The OTLP endpoint and headers come
+	// from the standard OTEL_EXPORTER_OTLP_* variables.
+	Exporter    string  `yaml:"exporter"`
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+type Static struct {
+	// Dir serves /app/ from disk instead of the assets built into the
+	// binary. It is read once at startup.
+	Dir string `yaml:"dir"`
+	// Live rereads Dir on every request so frontend edits show up without
+	// a restart. Each request then reads and hashes the whole directory,
+	// so never turn it on where the server is reachable by others.
+	Live bool `yaml:"live"`
+}
+
+type Polka struct {
+	// APIKey authenticates the payment provider's webhook calls. With no
+	// key set every webhook is rejected.
+	APIKey string `yaml:"api_key"`
+}
+
+type Metrics struct {
+	// Token is the bearer token Prometheus scrapes /metrics with. With no
+	// token set /metrics needs an admin's access token instead.
+	Token string `yaml:"token"`
+}
+
+type Content struct {
+	// BannedWordsFile lists words masked out of chirps, one per line. It is
+	// reread on SIGHUP and POST /admin/content/reload.
+	BannedWordsFile string `yaml:"banned_words_file"`
+	// Limits are in grapheme clusters; every URL counts as URLWeight.
+	MaxLength          int `yaml:"max_length"`
+	ChirpyRedMaxLength int `yaml:"chirpy_red_max_length"`
+	URLWeight          int `yaml:"url_weight"`
+}
+
+// Login throttles password guessing. Per account, each failure delays the
+// next attempt by BaseDelay doubling up to MaxDelay, and MaxFailures
+// within FailureWindow locks the account for Lockout. Per IP there is no
+// delay, only the lockout after IPMaxFailures, so users behind a shared
+// address aren't slowed down by each other's typos. The per-IP lockout
+// needs Server.TrustedProxies.
+type Login struct {
+	MaxFailures   int           `yaml:"max_failures"`
+	IPMaxFailures int           `yaml:"ip_max_failures"`
+	Lockout       time.Duration `yaml:"lockout"`
+	BaseDelay     time.Duration `yaml:"base_delay"`
+	MaxDelay      time.Duration `yaml:"max_delay"`
+	FailureWindow time.Duration `yaml:"failure_window"`
+}
+
+// Password selects how new passwords are hashed and what they must look
+// like. Hashes made with another scheme or older costs still verify and
+// are replaced on the next login.
+type Password struct {
+	MinLength int `yaml:"min_length"`
+	// MaxBytes is lowered to 72 while bcrypt is the scheme, since bcrypt
+	// ignores anything after that.
+	MaxBytes int `yaml:"max_bytes"`
+	// BreachedDir optionally holds breached SHA-1 hashes as HIBP range
+	// files, one per 5 character prefix; passwords found in it are refused.
+	BreachedDir string `yaml:"breached_dir"`
+
+	// Scheme is argon2id or bcrypt.
+	Scheme        string `yaml:"scheme"`
+	Argon2Memory  int    `yaml:"argon2_memory_kib"`
+	Argon2Time    int    `yaml:"argon2_time"`
+	Argon2Threads int    `yaml:"argon2_threads"`
+	BcryptCost    int    `yaml:"bcrypt_cost"`
+}
+
+// TrustedPrefixes parses TrustedProxies, which validate has already
+// checked. A bare address is a prefix of its full length.
+func (s Server) TrustedPrefixes() []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, proxy := range s.TrustedProxies {
+		if p, err := parsePrefix(proxy); err == nil {
+			prefixes = append(prefixes, p)
+		}
+	}
+	return prefixes
+}
+
+func parsePrefix(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "/") {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	return netip.ParsePrefix(s)
+}
+
+// MinSecretLength is the shortest HS256 secret accepted, matching the
+// 256-bit output of the hash.
+const MinSecretLength = 32
+
+func Default() Config {
+	return Config{
+		Server: Server{
+			Addr:              ":8080",
+			ReadTimeout:       10 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      15 * time.Second,
+			IdleTimeout:       60 * time.Second,
+			ShutdownTimeout:   20 * time.Second,
+			MaxHeaderBytes:    http.DefaultMaxHeaderBytes,
+		},
+		JWT: JWT{
+			Issuer:   "Chirpy",
+			Audience: "chirpy",
+			Leeway:   30 * time.Second,
+		},
+		Log: Log{
+			Level: "info",
+		},
+		Content: Content{
+			MaxLength:          140,
+			ChirpyRedMaxLength: 560,
+			URLWeight:          23,
+		},
+		Login: Login{
+			MaxFailures:   5,
+			IPMaxFailures: 100,
+			Lockout:       15 * time.Minute,
+			BaseDelay:     time.Second,
+			MaxDelay:      30 * time.Second,
+			FailureWindow: 15 * time.Minute,
+		},
+		Password: Password{
+			MinLength:     8,
+			MaxBytes:      1024,
+			Scheme:        "argon2id",
+			Argon2Memory:  64 * 1024,
+			Argon2Time:    3,
+			Argon2Threads: 4,
+			BcryptCost:    10,
+		},
+		Tracing: Tracing{
+			Exporter:    "none",
+			SampleRatio: 1,
+		},
+	}
+}
+
+// Load builds the configuration from all sources and validates it. Every
+// problem found is reported at once rather than one per restart.
+func Load(args []string) (Config, error) {
+	cfg, problems, err := load(args)
+	if err != nil {
+		return Config{}, err
+	}
+	problems = append(problems, cfg.validate()...)
+	if err := problemsError(problems); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// LoadDB is Load for commands that only talk to the database, such as
+// migrate: the sources are layered the same way but only DB_URL has to be
+// valid, so they run without the server's secrets.
+func LoadDB(args []string) (Config, error) {
+	cfg, problems, err := load(args)
+	if err != nil {
+		return Config{}, err
+	}
+	if cfg.DBURL == "" {
+		problems = append(problems, "DB_URL is required")
+	}
+	if err := problemsError(problems); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+func problemsError(problems []string) error {
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// load layers the sources over the defaults, returning a problem for each
+// value that could not be read. A flag parse error is returned as is.
+func load(args []string) (Config, []string, error) {
+	godotenv.Load()
+	cfg := Default()
+
+	fs := flag.NewFlagSet("httpserv", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML config file")
+	fs.BoolVar(&cfg.MigrateOnStart, "migrate-on-start", cfg.MigrateOnStart, "apply pending migrations before listening")
+	fs.StringVar(&cfg.Server.Addr, "addr", cfg.Server.Addr, "listen address")
+	fs.DurationVar(&cfg.Server.ReadTimeout, "read-timeout", cfg.Server.ReadTimeout, "max time to read a whole request")
+	fs.DurationVar(&cfg.Server.ReadHeaderTimeout, "read-header-timeout", cfg.Server.ReadHeaderTimeout, "max time to read request headers")
+	fs.DurationVar(&cfg.Server.WriteTimeout, "write-timeout", cfg.Server.WriteTimeout, "max time to write a response")
+	fs.DurationVar(&cfg.Server.IdleTimeout, "idle-timeout", cfg.Server.IdleTimeout, "keep-alive idle timeout")
+	fs.DurationVar(&cfg.Server.ShutdownTimeout, "shutdown-timeout", cfg.Server.ShutdownTimeout, "how long to drain in-flight requests on shutdown")
+	fs.DurationVar(&cfg.Server.DrainDelay, "drain-delay", cfg.Server.DrainDelay, "how long to report not-ready before shutting down")
+	fs.IntVar(&cfg.Server.MaxHeaderBytes, "max-header-bytes", cfg.Server.MaxHeaderBytes, "max size of request headers")
+	fs.StringVar(&cfg.Log.Level, "log-level", cfg.Log.Level, "debug, info, warn or error")
+	fs.StringVar(&cfg.Static.Dir, "static-dir", cfg.Static.Dir, "serve /app/ from this directory instead of the embedded assets")
+	fs.BoolVar(&cfg.Static.Live, "static-live", cfg.Static.Live, "reread -static-dir on every request; for frontend development only")
+	fs.StringVar(&cfg.Content.BannedWordsFile, "banned-words-file", cfg.Content.BannedWordsFile, "file of words to mask in chirps, one per line")
+	fs.IntVar(&cfg.Content.MaxLength, "chirp-max-length", cfg.Content.MaxLength, "chirp length limit in characters")
+	fs.IntVar(&cfg.Content.ChirpyRedMaxLength, "chirpy-red-max-length", cfg.Content.ChirpyRedMaxLength, "chirp length limit for Chirpy Red members")
+	fs.IntVar(&cfg.Content.URLWeight, "chirp-url-weight", cfg.Content.URLWeight, "characters each URL counts as")
+	fs.StringVar(&cfg.Tracing.Exporter, "trace-exporter", cfg.Tracing.Exporter, "none, stdout or otlp")
+	fs.Float64Var(&cfg.Tracing.SampleRatio, "trace-sample-ratio", cfg.Tracing.SampleRatio, "fraction of new traces to sample")
+	// the first parse only finds -config; flags are parsed again at the end
+	// so they win over the file and the environment
+	if err := fs.Parse(args); err != nil {
+		return Config{}, nil, err
+	}
+
+	var problems []string
+	if *configFile != "" {
+		if err := loadFile(*configFile, &cfg); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	problems = append(problems, applyEnv(&cfg)...)
+	fs.Parse(args)
+	return cfg, problems, nil
+}
+
+func loadFile(path string, cfg *Config) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// applyEnv overlays every variable that is set, returning a problem for
+// each one that doesn't parse.
+func applyEnv(cfg *Config) []string {
+	var problems []string
+	str := func(key string, dst *string) {
+		if v, ok := os.LookupEnv(key); ok && v != "" {
+			*dst = v
+		}
+	}
+	dur := func(key string, dst *time.Duration) {
+		v, ok := os.LookupEnv(key)
+		if !ok || v == "" {
+			return
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %q is not a duration", key, v))
+			return
+		}
+		*dst = d
+	}
+	num := func(key string, dst *int) {
+		v, ok := os.LookupEnv(key)
+		if !ok || v == "" {
+			return
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %q is not an integer", key, v))
+			return
+		}
+		*dst = n
+	}
+	boolean := func(key string, dst *bool) {
+		v, ok := os.LookupEnv(key)
+		if !ok || v == "" {
+			return
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %q is not a boolean", key, v))
+			return
+		}
+		*dst = b
+	}
+
+	str("DB_URL", &cfg.DBURL)
+	str("PLATFORM", &cfg.Platform)
+	boolean("MIGRATE_ON_START", &cfg.MigrateOnStart)
+
+	str("ADDR", &cfg.Server.Addr)
+	dur("READ_TIMEOUT", &cfg.Server.ReadTimeout)
+	dur("READ_HEADER_TIMEOUT", &cfg.Server.ReadHeaderTimeout)
+	dur("WRITE_TIMEOUT", &cfg.Server.WriteTimeout)
+	dur("IDLE_TIMEOUT", &cfg.Server.IdleTimeout)
+	dur("SHUTDOWN_TIMEOUT", &cfg.Server.ShutdownTimeout)
+	dur("DRAIN_DELAY", &cfg.Server.DrainDelay)
+	num("MAX_HEADER_BYTES", &cfg.Server.MaxHeaderBytes)
+	if v := os.Getenv("TRUSTED_PROXIES"); v != "" {
+		cfg.Server.TrustedProxies = strings.Split(v, ",")
+	}
+
+	str("TOKEN", &cfg.JWT.Secret)
+	str("JWT_SECRET_KEY_ID", &cfg.JWT.SecretKeyID)
+	str("JWT_SIGNING_KEY", &cfg.JWT.SigningKey)
+	if v := os.Getenv("JWT_VERIFY_KEYS"); v != "" {
+		cfg.JWT.VerifyKeys = strings.Split(v, ",")
+	}
+	str("JWT_ISSUER", &cfg.JWT.Issuer)
+	str("JWT_AUDIENCE", &cfg.JWT.Audience)
+	dur("JWT_LEEWAY", &cfg.JWT.Leeway)
+
+	str("LOG_LEVEL", &cfg.Log.Level)
+
+	str("STATIC_DIR", &cfg.Static.Dir)
+	boolean("STATIC_LIVE", &cfg.Static.Live)
+
+	str("POLKA_KEY", &cfg.Polka.APIKey)
+
+	str("METRICS_TOKEN", &cfg.Metrics.Token)
+
+	str("BANNED_WORDS_FILE", &cfg.Content.BannedWordsFile)
+	num("CHIRP_MAX_LENGTH", &cfg.Content.MaxLength)
+	num("CHIRPY_RED_MAX_LENGTH", &cfg.Content.ChirpyRedMaxLength)
+	num("CHIRP_URL_WEIGHT", &cfg.Content.URLWeight)
+
+	num("LOGIN_MAX_FAILURES", &cfg.Login.MaxFailures)
+	num("LOGIN_IP_MAX_FAILURES", &cfg.Login.IPMaxFailures)
+	dur("LOGIN_LOCKOUT", &cfg.Login.Lockout)
+	dur("LOGIN_BASE_DELAY", &cfg.Login.BaseDelay)
+	dur("LOGIN_MAX_DELAY", &cfg.Login.MaxDelay)
+	dur("LOGIN_FAILURE_WINDOW", &cfg.Login.FailureWindow)
+
+	str("PASSWORD_SCHEME", &cfg.Password.Scheme)
+	num("PASSWORD_MIN_LENGTH", &cfg.Password.MinLength)
+	num("PASSWORD_MAX_BYTES", &cfg.Password.MaxBytes)
+	str("BREACHED_PASSWORDS_DIR", &cfg.Password.BreachedDir)
+	num("ARGON2_MEMORY_KIB", &cfg.Password.Argon2Memory)
+	num("ARGON2_TIME", &cfg.Password.Argon2Time)
+	num("ARGON2_THREADS", &cfg.Password.Argon2Threads)
+	num("BCRYPT_COST", &cfg.Password.BcryptCost)
+
+	str("TRACING_EXPORTER", &cfg.Tracing.Exporter)
+	if v := os.Getenv("TRACING_SAMPLE_RATIO"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("TRACING_SAMPLE_RATIO: %q is not a number", v))
+		} else {
+			cfg.Tracing.SampleRatio = f
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// ValidationError lists every problem found while loading the config.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+func (cfg Config) validate() []string {
+	var problems []string
+
+	if cfg.DBURL == "" {
+		problems = append(problems, "DB_URL is required")
+	}
+
+	// without an asymmetric key every token is signed with the shared secret
+	if cfg.JWT.SigningKey == "" {
+		switch {
+		case cfg.JWT.Secret == "":
+			problems = append(problems, "TOKEN is required when JWT_SIGNING_KEY is not set")
+		case len(cfg.JWT.Secret) < MinSecretLength:
+			problems = append(problems, fmt.Sprintf("TOKEN must be at least %d bytes, got %d", MinSecretLength, len(cfg.JWT.Secret)))
+		}
+	}
+	if cfg.JWT.Issuer == "" {
+		problems = append(problems, "JWT_ISSUER must not be empty")
+	}
+	if cfg.JWT.Leeway < 0 {
+		problems = append(problems, "JWT_LEEWAY must not be negative")
+	}
+
+	if cfg.Server.Addr == "" {
+		problems = append(problems, "ADDR must not be empty")
+	}
+	timeouts := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"READ_TIMEOUT", cfg.Server.ReadTimeout},
+		{"READ_HEADER_TIMEOUT", cfg.Server.ReadHeaderTimeout},
+		{"WRITE_TIMEOUT", cfg.Server.WriteTimeout},
+		{"IDLE_TIMEOUT", cfg.Server.IdleTimeout},
+		{"SHUTDOWN_TIMEOUT", cfg.Server.ShutdownTimeout},
+	}
+	for _, t := range timeouts {
+		if t.d <= 0 {
+			problems = append(problems, t.name+" must be positive")
+		}
+	}
+	if cfg.Server.DrainDelay < 0 {
+		problems = append(problems, "DRAIN_DELAY must not be negative")
+	}
+	if cfg.Server.MaxHeaderBytes <= 0 {
+		problems = append(problems, "MAX_HEADER_BYTES must be positive")
+	}
+	for _, proxy := range cfg.Server.TrustedProxies {
+		if _, err := parsePrefix(proxy); err != nil {
+			problems = append(problems, fmt.Sprintf("TRUSTED_PROXIES: %q is not an address or CIDR", proxy))
+		}
+	}
+
+	switch strings.ToLower(cfg.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		problems = append(problems, fmt.Sprintf("LOG_LEVEL must be debug, info, warn or error, got %q", cfg.Log.Level))
+	}
+
+	if cfg.Static.Dir != "" {
+		if info, err := os.Stat(cfg.Static.Dir); err != nil || !info.IsDir() {
+			problems = append(problems, fmt.Sprintf("STATIC_DIR %q is not a directory", cfg.Static.Dir))
+		}
+	}
+	if cfg.Static.Live && cfg.Static.Dir == "" {
+		problems = append(problems, "STATIC_LIVE needs STATIC_DIR")
+	}
+
+	if cfg.Content.MaxLength <= 0 {
+		problems = append(problems, "CHIRP_MAX_LENGTH must be positive")
+	}
+	if cfg.Content.ChirpyRedMaxLength < cfg.Content.MaxLength {
+		problems = append(problems, "CHIRPY_RED_MAX_LENGTH must be at least CHIRP_MAX_LENGTH")
+	}
+	if cfg.Content.URLWeight <= 0 || cfg.Content.URLWeight > cfg.Content.MaxLength {
+		problems = append(problems, "CHIRP_URL_WEIGHT must be positive and no more than CHIRP_MAX_LENGTH")
+	}
+
+	if cfg.Login.MaxFailures <= 0 {
+		problems = append(problems, "LOGIN_MAX_FAILURES must be positive")
+	}
+	if cfg.Login.IPMaxFailures < cfg.Login.MaxFailures {
+		problems = append(problems, "LOGIN_IP_MAX_FAILURES must be at least LOGIN_MAX_FAILURES")
+	}
+	if cfg.Login.Lockout <= 0 || cfg.Login.FailureWindow <= 0 {
+		problems = append(problems, "LOGIN_LOCKOUT and LOGIN_FAILURE_WINDOW must be positive")
+	}
+	if cfg.Login.BaseDelay < 0 || cfg.Login.MaxDelay < cfg.Login.BaseDelay {
+		problems = append(problems, "LOGIN_BASE_DELAY must not be negative or above LOGIN_MAX_DELAY")
+	}
+
+	if cfg.Password.MinLength < 1 {
+		problems = append(problems, "PASSWORD_MIN_LENGTH must be positive")
+	}
+	if cfg.Password.MaxBytes < cfg.Password.MinLength {
+		problems = append(problems, "PASSWORD_MAX_BYTES must be at least PASSWORD_MIN_LENGTH")
+	}
+	switch cfg.Password.Scheme {
+	case "argon2id", "bcrypt":
+	default:
+		problems = append(problems, fmt.Sprintf("PASSWORD_SCHEME must be argon2id or bcrypt, got %q", cfg.Password.Scheme))
+	}
+	if cfg.Password.Argon2Threads < 1 || cfg.Password.Argon2Threads > 255 {
+		problems = append(problems, "ARGON2_THREADS must be between 1 and 255")
+	}
+	if cfg.Password.Argon2Time < 1 {
+		problems = append(problems, "ARGON2_TIME must be positive")
+	}
+	// argon2 needs at least 8 KiB per lane; much less than that isn't a
+	// meaningful cost anyway
+	if cfg.Password.Argon2Memory < 8*max(cfg.Password.Argon2Threads, 1) || cfg.Password.Argon2Memory > 4*1024*1024 {
+		problems = append(problems, "ARGON2_MEMORY_KIB must be at least 8 per thread and at most 4194304")
+	}
+	if cfg.Password.BcryptCost < 4 || cfg.Password.BcryptCost > 31 {
+		problems = append(problems, "BCRYPT_COST must be between 4 and 31")
+	}
+
+	switch cfg.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	default:
+		problems = append(problems, fmt.Sprintf("TRACING_EXPORTER must be none, stdout or otlp, got %q", cfg.Tracing.Exporter))
+	}
+	if cfg.Tracing.SampleRatio < 0 || cfg.Tracing.SampleRatio > 1 {
+		problems = append(problems, "TRACING_SAMPLE_RATIO must be between 0 and 1")
+	}
+
+	return problems
+}
@@ -0,0 +1,184 @@
+package content
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"sync/atomic"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Replacement is what every banned word turns into.
+const Replacement = "****"
+
+// DefaultBannedWords is used when no word list file is configured.
+var DefaultBannedWords = []string{"kerfuffle", "sharbert", "fornax"}
+
+// Filter cleans chirp bodies. The banned word list can be swapped with
+// Reload while requests are being served.
+type Filter struct {
+	path   string
+	banned atomic.Pointer[map[string]struct{}]
+}
+
+// NewFilter loads the word list at path, one word per line with # starting
+// a comment. An empty path uses DefaultBannedWords and makes Reload a no-op.
+func NewFilter(path string) (*Filter, error) {
+	f := &Filter{path: path}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Reload rereads the word list file. On error the previous list stays.
+func (f *Filter) Reload() error {
+	words := DefaultBannedWords
+	if f.path != "" {
+		var err error
+		words, err = readWordList(f.path)
+		if err != nil {
+			return err
+		}
+	}
+	set := make(map[string]struct{}, len(words))
+	for _, w := range words {
+		set[fold(w)] = struct{}{}
+	}
+	f.banned.Store(&set)
+	return nil
+}
+
+// Len is how many banned words are currently loaded.
+func (f *Filter) Len() int {
+	return len(*f.banned.Load())
+}
+
+// Clean runs the whole pipeline: NFC normalisation, removal of invisible
+// characters, then masking of banned words. Punctuation around a banned
+// word is kept, so "kerfuffle!" becomes "****!".
+func (f *Filter) Clean(body string) string {
+	body = norm.NFC.String(body)
+	body = stripInvisible(body)
+	return f.mask(strings.TrimSpace(body))
+}
+
+// mask replaces each word (a run of letters, digits and combining marks)
+// found in the banned list.
+func (f *Filter) mask(body string) string {
+	banned := *f.banned.Load()
+	var b strings.Builder
+	b.Grow(len(body))
+	start := -1
+	flush := func(end int) {
+		if start < 0 {
+			return
+		}
+		word := body[start:end]
+		if _, ok := banned[fold(word)]; ok {
+			word = Replacement
+		}
+		b.WriteString(word)
+		start = -1
+	}
+	for i, r := range body {
+		if isWordRune(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		flush(i)
+		b.WriteRune(r)
+	}
+	flush(len(body))
+	return b.String()
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+}
+
+// stripInvisible drops control characters other than newline and tab,
+// bidi overrides, and zero-width characters that can hide a banned word
+// ("ker\u200bfuffle"). A zero-width joiner is kept only where it joins
+// two parts of one grapheme cluster, which is how emoji sequences such as
+// families and professions are built, or after a virama in an Indic
+// conjunct; between letters of a word it would just split the word.
+func stripInvisible(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		switch {
+		case r == '\n' || r == '\t':
+		case unicode.IsControl(r):
+			continue
+		case r == '\u200b', r == '\u200c', r == '\u2060', r == '\ufeff', r == '\u00ad':
+			continue
+		case r >= '\u202a' && r <= '\u202e', r >= '\u2066' && r <= '\u2069':
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return stripLooseJoiners(b.String())
+}
+
+// stripLooseJoiners removes each zero-width joiner that ends its grapheme
+// cluster, i.e. one that doesn't join to what follows it, unless it
+// follows a virama.
+func stripLooseJoiners(s string) string {
+	if !strings.ContainsRune(s, '\u200d') {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	state := -1
+	for s != "" {
+		var cluster string
+		cluster, s, _, state = uniseg.FirstGraphemeClusterInString(s, state)
+		for {
+			trimmed, ok := strings.CutSuffix(cluster, "\u200d")
+			if !ok || (s != "" && afterVirama(trimmed)) {
+				break
+			}
+			cluster = trimmed
+		}
+		b.WriteString(cluster)
+	}
+	return b.String()
+}
+
+// afterVirama reports whether s ends in a virama. A joiner there asks for
+// the half form of an Indic conjunct, which this version of uniseg still
+// splits into two clusters.
+func afterVirama(s string) bool {
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return norm.NFC.PropertiesString(string(r)).CCC() == 9
+}
+
+// fold gives the form words are compared in.
+func fold(s string) string {
+	return strings.ToLower(norm.NFC.String(s))
+}
+
+func readWordList(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if word := strings.TrimSpace(line); word != "" {
+			words = append(words, word)
+		}
+	}
+	return words, scanner.Err()
+}
@@ -0,0 +1,94 @@
+package content
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFilterClean(t *testing.T) {
+	f, err := NewFilter("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", "what a kerfuffle", "what a ****"},
+		{"clean text untouched", "nothing to see here", "nothing to see here"},
+		{"case folded", "KerFuffle and SHARBERT", "**** and ****"},
+		{"punctuation kept", "(kerfuffle), fornax! \"sharbert\"?", "(****), ****! \"****\"?"},
+		{"part of a longer word", "kerfuffles", "kerfuffles"},
+		{"zero-width space", "ker\u200bfuffle", "****"},
+		{"zero-width joiner between letters", "ker\u200dfuffle", "****"},
+		{"zero-width non-joiner", "ker\u200cfuffle", "****"},
+		{"soft hyphen", "ker\u00adfuf\u00adfle", "****"},
+		{"word joiner and BOM", "\ufeffker\u2060fuffle", "****"},
+		{"bidi override", "\u202ekerfuffle\u202c", "****"},
+		{"control character", "ker\x00fuffle", "****"},
+		{"newline and tab kept", "one\ttwo\nthree", "one\ttwo\nthree"},
+		{"decomposed accent normalised", "cafe\u0301", "café"},
+		{"surrounding space trimmed", "  hi  ", "hi"},
+		{"family emoji kept", "\U0001F468\u200d\U0001F469\u200d\U0001F467", "\U0001F468\u200d\U0001F469\u200d\U0001F467"},
+		{"skin tone profession kept", "\U0001F469\U0001F3FD\u200d\U0001F4BB", "\U0001F469\U0001F3FD\u200d\U0001F4BB"},
+		{"variation selector sequence kept", "❤\ufe0f\u200d\U0001F525", "❤\ufe0f\u200d\U0001F525"},
+		{"trailing joiner after emoji dropped", "\U0001F44D\u200d", "\U0001F44D"},
+		{"devanagari half form kept", "क\u094d\u200dष", "क\u094d\u200dष"},
+		{"joiner after final virama dropped", "क\u094d\u200d", "क\u094d"},
+		{"emoji next to banned word", "\U0001F600kerfuffle\U0001F600", "\U0001F600****\U0001F600"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := f.Clean(tt.in); got != tt.want {
+				t.Errorf("Clean(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "banned.txt")
+	if err := os.WriteFile(path, []byte("# words to mask\nbazinga\n\n  Gubbins  # trailing comment\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFilter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Len() != 2 {
+		t.Errorf("Len = %d, want 2", f.Len())
+	}
+	if got := f.Clean("bazinga gubbins kerfuffle"); got != "**** **** kerfuffle" {
+		t.Errorf("Clean = %q, want the file's words masked and the defaults not", got)
+	}
+
+	if err := os.WriteFile(path, []byte("kerfuffle\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.Clean("bazinga kerfuffle"); got != "bazinga ****" {
+		t.Errorf("after Reload Clean = %q, want the new list in use", got)
+	}
+
+	// an unreadable file keeps the list that was loaded
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Reload(); err == nil {
+		t.Error("Reload of a missing file succeeded")
+	}
+	if got := f.Clean("bazinga kerfuffle"); got != "bazinga ****" {
+		t.Errorf("after a failed Reload Clean = %q, want the old list still in use", got)
+	}
+}
+
+func TestNewFilterMissingFile(t *testing.T) {
+	if _, err := NewFilter(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("NewFilter with a missing file succeeded")
+	}
+}
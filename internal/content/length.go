@@ -0,0 +1,40 @@
+package content
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/rivo/uniseg"
+)
+
+// Limits are the chirp length rules for a deployment. Length is counted
+// in grapheme clusters, so "é", "字" and a flag emoji are one character
+// each, and every URL costs URLWeight however long it is.
+type Limits struct {
+	Standard  int
+	ChirpyRed int
+	URLWeight int
+}
+
+var urlPattern = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"]+`)
+
+// Max is the limit for a user on the given tier.
+func (l Limits) Max(chirpyRed bool) int {
+	if chirpyRed {
+		return l.ChirpyRed
+	}
+	return l.Standard
+}
+
+// Length counts body the way Max is enforced.
+func (l Limits) Length(body string) int {
+	n := 0
+	last := 0
+	for _, loc := range urlPattern.FindAllStringIndex(body, -1) {
+		// trailing punctuation usually ends the sentence, not the URL
+		end := loc[0] + len(strings.TrimRight(body[loc[0]:loc[1]], ".,;:!?)]}'"))
+		n += uniseg.GraphemeClusterCount(body[last:loc[0]]) + l.URLWeight
+		last = end
+	}
+	return n + uniseg.GraphemeClusterCount(body[last:])
+}
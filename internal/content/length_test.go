@@ -0,0 +1,59 @@
+package content
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLimitsLength(t *testing.T) {
+	l := Limits{Standard: 140, ChirpyRed: 560, URLWeight: 23}
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"empty", "", 0},
+		{"ascii", "hello world", 11},
+		{"precomposed accent", "café", 4},
+		{"combining accent", "cafe\u0301", 4},
+		{"stacked combining marks", "a\u0301\u0323\u0308", 1},
+		{"cjk", "你好世界", 4},
+		{"flag", "\U0001F1EF\U0001F1F5", 1},
+		{"two flags", "\U0001F1EF\U0001F1F5\U0001F1EB\U0001F1F7", 2},
+		{"skin tone", "\U0001F44D\U0001F3FD", 1},
+		{"zwj family", "\U0001F468\u200d\U0001F469\u200d\U0001F467\u200d\U0001F466", 1},
+		{"crlf is one", "a\r\nb", 3},
+		{"url alone", "https://example.com/a/very/long/path?with=query&and=more", 23},
+		{"short url still full weight", "http://a.io", 23},
+		{"url in text", "see https://example.com now", 4 + 23 + 4},
+		{"two urls", "https://a.example https://b.example/x", 23 + 1 + 23},
+		{"url then full stop", "go to https://example.com.", 6 + 23 + 1},
+		{"url in parentheses", "(https://example.com/x)", 1 + 23 + 1},
+		{"url then several marks", "https://example.com/x?!", 23 + 2},
+		{"uppercase scheme", "HTTPS://EXAMPLE.COM", 23},
+		{"not a url", "ftp://example.com", 17},
+		{"url among emoji", "\U0001F600 https://example.com \U0001F600", 2 + 23 + 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := l.Length(tt.body); got != tt.want {
+				t.Errorf("Length(%q) = %d, want %d", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimitsMax(t *testing.T) {
+	l := Limits{Standard: 140, ChirpyRed: 560, URLWeight: 23}
+	if got := l.Max(false); got != 140 {
+		t.Errorf("Max(false) = %d, want 140", got)
+	}
+	if got := l.Max(true); got != 560 {
+		t.Errorf("Max(true) = %d, want 560", got)
+	}
+	// a body exactly at the limit fits
+	if got := l.Length(strings.Repeat("字", 140)); got != l.Max(false) {
+		t.Errorf("Length of 140 CJK characters = %d, want 140", got)
+	}
+}
@@ -0,0 +1,34 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: chirpyred.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const setChirpyRed = `-- name: SetChirpyRed :execrows
+UPDATE users
+SET is_chirpy_red = $2,
+    updated_at = CASE WHEN is_chirpy_red = $2 THEN updated_at ELSE NOW() END
+WHERE id = $1
+`
+
+type SetChirpyRedParams struct {
+	ID          uuid.UUID
+	IsChirpyRed bool
+}
+
+// updated_at only moves when the flag actually changes, so replayed
+// webhook deliveries leave the row untouched
+func (q *Queries) SetChirpyRed(ctx context.Context, arg SetChirpyRedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setChirpyRed, arg.ID, arg.IsChirpyRed)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
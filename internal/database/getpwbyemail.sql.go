@@ -10,7 +10,7 @@ import (
 )
 
 const getPwByEmail = `-- name: GetPwByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password FROM users WHERE email = $1
+SELECT id, created_at, updated_at, email, hashed_password, role, is_chirpy_red FROM users WHERE email = $1
 `
 
 func (q *Queries) GetPwByEmail(ctx context.Context, email string) (User, error) {
@@ -22,6 +22,8 @@ func (q *Queries) GetPwByEmail(ctx context.Context, email string) (User, error)
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
+		&i.Role,
+		&i.IsChirpyRed,
 	)
 	return i, err
 }
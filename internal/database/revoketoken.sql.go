@@ -9,21 +9,34 @@ import (
 	"context"
 	"database/sql"
 	"time"
+
+	"github.com/google/uuid"
 )
 
+const revokeAllUserRTokens = `-- name: RevokeAllUserRTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeAllUserRTokens(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeAllUserRTokens, userID)
+	return err
+}
+
 const revokeRToken = `-- name: RevokeRToken :exec
 UPDATE refresh_tokens
 SET revoked_at = $2, updated_at = $3
-WHERE token = $1
+WHERE token_hash = $1
 `
 
 type RevokeRTokenParams struct {
-	Token     string
+	TokenHash string
 	RevokedAt sql.NullTime
 	UpdatedAt time.Time
 }
 
 func (q *Queries) RevokeRToken(ctx context.Context, arg RevokeRTokenParams) error {
-	_, err := q.db.ExecContext(ctx, revokeRToken, arg.Token, arg.RevokedAt, arg.UpdatedAt)
+	_, err := q.db.ExecContext(ctx, revokeRToken, arg.TokenHash, arg.RevokedAt, arg.UpdatedAt)
 	return err
 }
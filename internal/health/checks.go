@@ -0,0 +1,32 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Ping checks that Postgres accepts connections.
+func Ping(db *sql.DB) Check {
+	return Check{Name: "database", Run: db.PingContext}
+}
+
+// MigrationVersion checks that goose has applied at least the schema
+// version this binary was built against, since behind means queries would
+// hit missing columns. Ahead is fine: during a rolling deploy the new
+// release migrates first and the old one must keep serving.
+func MigrationVersion(db *sql.DB, want int64) Check {
+	return Check{Name: "migrations", Run: func(ctx context.Context) error {
+		var got int64
+		err := db.QueryRowContext(ctx,
+			`SELECT MAX(version_id) FROM goose_db_version WHERE is_applied`,
+		).Scan(&got)
+		if err != nil {
+			return err
+		}
+		if got < want {
+			return fmt.Errorf("schema is at version %d, want at least %d", got, want)
+		}
+		return nil
+	}}
+}
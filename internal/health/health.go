@@ -0,0 +1,111 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"httpserv/internal/logging"
+)
+
+// DefaultTimeout bounds how long a readiness probe waits on all checks.
+const DefaultTimeout = 2 * time.Second
+
+// Check is one dependency readiness depends on. Run should return quickly
+// and honour ctx; its error is logged but never shown to the caller.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Checker serves /livez and /readyz. Readiness runs every check on each
+// probe and turns unavailable as soon as shutdown begins, so load
+// balancers stop routing new traffic while requests drain.
+type Checker struct {
+	checks   []Check
+	timeout  time.Duration
+	draining atomic.Bool
+}
+
+func New(timeout time.Duration, checks ...Check) *Checker {
+	return &Checker{checks: checks, timeout: timeout}
+}
+
+// SetDraining marks the server as shutting down. It can't be undone.
+func (c *Checker) SetDraining() {
+	c.draining.Store(true)
+}
+
+type checkResult struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+}
+
+type report struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks,omitempty"`
+}
+
+const (
+	statusOK          = "ok"
+	statusFail        = "fail"
+	statusUnavailable = "unavailable"
+	statusDraining    = "draining"
+)
+
+// Livez only says the process is up and serving HTTP; it deliberately
+// checks nothing else so a database outage doesn't get the pod restarted.
+func (c *Checker) Livez(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, http.StatusOK, report{Status: statusOK})
+}
+
+func (c *Checker) Readyz(w http.ResponseWriter, r *http.Request) {
+	if c.draining.Load() {
+		writeReport(w, http.StatusServiceUnavailable, report{Status: statusDraining})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), c.timeout)
+	defer cancel()
+
+	results := make([]checkResult, len(c.checks))
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			err := check.Run(ctx)
+			results[i] = checkResult{
+				Status:    statusOK,
+				LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				results[i].Status = statusFail
+				logging.FromContext(r.Context()).Warn("readiness check failed", "check", check.Name, "error", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	rep := report{Status: statusOK, Checks: make(map[string]checkResult, len(c.checks))}
+	status := http.StatusOK
+	for i, check := range c.checks {
+		rep.Checks[check.Name] = results[i]
+		if results[i].Status != statusOK {
+			rep.Status = statusUnavailable
+			status = http.StatusServiceUnavailable
+		}
+	}
+	writeReport(w, status, rep)
+}
+
+func writeReport(w http.ResponseWriter, status int, rep report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(rep)
+}
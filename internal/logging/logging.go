@@ -0,0 +1,91 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"httpserv/internal/requestid"
+	"httpserv/internal/response"
+)
+
+// New returns a JSON logger at the given level ("debug", "info", "warn"
+// or "error").
+func New(w io.Writer, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, err
+	}
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: lvl})), nil
+}
+
+// requestState is shared between the access log middleware and everything
+// inside it, so attributes learned deep in the stack (like the user ID
+// from the auth middleware) still end up on the access log line.
+type requestState struct {
+	mu     sync.Mutex
+	logger *slog.Logger
+	userID string
+}
+
+type ctxKey struct{}
+
+// FromContext returns the request-scoped logger, or slog.Default() outside
+// of a request.
+func FromContext(ctx context.Context) *slog.Logger {
+	if st, ok := ctx.Value(ctxKey{}).(*requestState); ok {
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		return st.logger
+	}
+	return slog.Default()
+}
+
+// SetUserID attaches the authenticated user to the request's logger and
+// access log entry.
+func SetUserID(ctx context.Context, userID string) {
+	if st, ok := ctx.Value(ctxKey{}).(*requestState); ok {
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		st.userID = userID
+		st.logger = st.logger.With("user_id", userID)
+	}
+}
+
+// Middleware writes one access log entry per request. It has to sit inside
+// requestid.Middleware to pick up the request ID.
+func Middleware(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			st := &requestState{
+				logger: logger.With("request_id", requestid.FromContext(r.Context())),
+			}
+			rec := response.NewRecorder(w)
+			response.ServeWithContext(next, rec, r, context.WithValue(r.Context(), ctxKey{}, st))
+
+			level := slog.LevelInfo
+			if rec.Status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+
+			st.mu.Lock()
+			userID := st.userID
+			st.mu.Unlock()
+			logger.LogAttrs(r.Context(), level, "request",
+				slog.String("request_id", requestid.FromContext(r.Context())),
+				slog.String("method", r.Method),
+				slog.String("route", response.Route(r)),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", rec.Status),
+				slog.Int("bytes", rec.Bytes),
+				slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+				slog.String("remote_ip", response.ClientIP(r)),
+				slog.String("user_id", userID),
+			)
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+
+	"httpserv/sql/schema"
+
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+// Commands lists the subcommands Run understands.
+const Commands = "up, down, status or redo"
+
+// NewProvider returns a goose provider over the embedded sql/schema files.
+// Every run holds a Postgres advisory lock, so replicas starting together
+// with -migrate-on-start apply each migration exactly once.
+func NewProvider(db *sql.DB) (*goose.Provider, error) {
+	locker, err := lock.NewPostgresSessionLocker()
+	if err != nil {
+		return nil, err
+	}
+	return goose.NewProvider(goose.DialectPostgres, db, schema.FS, goose.WithSessionLocker(locker))
+}
+
+// Latest is the newest migration version embedded in the binary.
+func Latest(p *goose.Provider) int64 {
+	sources := p.ListSources()
+	if len(sources) == 0 {
+		return 0
+	}
+	return sources[len(sources)-1].Version
+}
+
+// Run executes one migrate subcommand, reporting what it did to w.
+func Run(ctx context.Context, p *goose.Provider, command string, w io.Writer) error {
+	switch command {
+	case "up":
+		results, err := p.Up(ctx)
+		for _, res := range results {
+			fmt.Fprintln(w, res)
+		}
+		if err != nil {
+			return err
+		}
+		if len(results) == 0 {
+			fmt.Fprintln(w, "no pending migrations")
+		}
+		return nil
+	case "down":
+		res, err := p.Down(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, res)
+		return nil
+	case "redo":
+		down, err := p.Down(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, down)
+		up, err := p.UpByOne(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, up)
+		return nil
+	case "status":
+		statuses, err := p.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, st := range statuses {
+			applied := "pending"
+			if st.State == goose.StateApplied {
+				applied = st.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%-20s %s\n", applied, st.Source.Path)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown migrate command %q, want %s", command, Commands)
+}
@@ -0,0 +1,45 @@
+package problem
+
+import "net/http"
+
+// Mux sends the 404 and 405 responses mux makes up itself for unmatched
+// requests as problems, like every other error, instead of text/plain.
+// Requests that match a pattern go straight through.
+func Mux(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); pattern != "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		mux.ServeHTTP(&unmatchedWriter{ResponseWriter: w, r: r}, r)
+	})
+}
+
+// unmatchedWriter replaces the mux's plain-text error body with a problem.
+// Anything else, such as the redirect to a cleaned path, passes through.
+type unmatchedWriter struct {
+	http.ResponseWriter
+	r        *http.Request
+	replaced bool
+}
+
+func (uw *unmatchedWriter) WriteHeader(status int) {
+	switch status {
+	case http.StatusNotFound:
+		uw.replaced = true
+		Write(uw.ResponseWriter, uw.r, status, NotFound, "no such route")
+	case http.StatusMethodNotAllowed:
+		// the mux has already set Allow
+		uw.replaced = true
+		Write(uw.ResponseWriter, uw.r, status, BadMethod, uw.r.Method+" is not allowed here")
+	default:
+		uw.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (uw *unmatchedWriter) Write(b []byte) (int, error) {
+	if uw.replaced {
+		return len(b), nil
+	}
+	return uw.ResponseWriter.Write(b)
+}
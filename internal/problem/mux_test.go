@@ -0,0 +1,58 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMux(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/chirps", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	h := Mux(mux)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		status int
+		code   string
+		allow  string
+	}{
+		{"matched", http.MethodGet, "/api/chirps", http.StatusOK, "", ""},
+		{"unknown path", http.MethodGet, "/api/nope", http.StatusNotFound, NotFound, ""},
+		{"wrong method", http.MethodDelete, "/api/chirps", http.StatusMethodNotAllowed, BadMethod, "GET, HEAD"},
+		{"cleaned path", http.MethodGet, "/api//chirps", http.StatusTemporaryRedirect, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if got := rec.Header().Get("Allow"); got != tt.allow {
+				t.Errorf("Allow = %q, want %q", got, tt.allow)
+			}
+			if tt.code == "" {
+				if ct := rec.Header().Get("Content-Type"); ct == ContentType {
+					t.Errorf("Content-Type = %q for a non-error response", ct)
+				}
+				return
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != ContentType {
+				t.Errorf("Content-Type = %q, want %q", ct, ContentType)
+			}
+			var p Problem
+			if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+				t.Fatalf("body %q: %v", rec.Body, err)
+			}
+			if p.Type != typePrefix+tt.code || p.Status != tt.status {
+				t.Errorf("problem = %+v, want code %q status %d", p, tt.code, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"httpserv/internal/logging"
+	"httpserv/internal/requestid"
+)
+
+// ContentType is the RFC 7807 media type for error bodies.
+const ContentType = "application/problem+json"
+
+// Stable machine-readable error codes. Clients should branch on these,
+// never on Title or Detail.
+const (
+	InvalidBody   = "invalid-body"
+	InvalidParam  = "invalid-parameter"
+	Unauthorized  = "unauthorized"
+	Forbidden     = "forbidden"
+	NotFound      = "not-found"
+	BadMethod     = "method-not-allowed"
+	Conflict      = "conflict"
+	ChirpTooLong  = "chirp-too-long"
+	InvalidLogin  = "invalid-credentials"
+	TooManyLogins = "too-many-attempts"
+	InvalidFields = "validation-failed"
+	InternalError = "internal-error"
+)
+
+const typePrefix = "urn:chirpy:problem:"
+
+// Problem is an RFC 7807 problem details object.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	// Errors lists every invalid field when the request as a whole parsed
+	// but its contents didn't pass validation.
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError is one validation failure. Code is stable for clients to
+// branch on; Message is for humans.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Write sends a problem response. detail must be safe to show to clients.
+func Write(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	write(w, r, status, code, detail, nil)
+}
+
+// WriteFields sends a 400 listing each field that failed validation.
+func WriteFields(w http.ResponseWriter, r *http.Request, errs []FieldError) {
+	write(w, r, http.StatusBadRequest, InvalidFields, "one or more fields are invalid", errs)
+}
+
+func write(w http.ResponseWriter, r *http.Request, status int, code, detail string, errs []FieldError) {
+	p := Problem{
+		Type:      typePrefix + code,
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		RequestID: requestid.FromContext(r.Context()),
+		Errors:    errs,
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// Internal logs err with the request ID and sends a generic 500 so that
+// database and library errors never reach the client.
+func Internal(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	logging.FromContext(r.Context()).Error(msg, "error", err)
+	Write(w, r, http.StatusInternalServerError, InternalError, "an internal error occurred")
+}
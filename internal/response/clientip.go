@@ -0,0 +1,72 @@
+package response
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type clientIPKey struct{}
+
+// ClientIP is the address of the client that sent r, without the port.
+// That is the peer itself unless TrustProxies found the client in
+// X-Forwarded-For.
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return peerIP(r)
+}
+
+func peerIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// TrustProxies returns middleware that believes X-Forwarded-For, but only
+// on requests whose peer is inside one of trusted. The client is the
+// rightmost address in the header that isn't itself a trusted proxy, since
+// anything to its left was written by the client and can say anything.
+// With no trusted proxies the header is always ignored.
+func TrustProxies(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	isTrusted := func(s string) bool {
+		addr, err := netip.ParseAddr(strings.TrimSpace(s))
+		if err != nil {
+			return false
+		}
+		addr = addr.Unmap()
+		for _, p := range trusted {
+			if p.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			peer := peerIP(r)
+			if len(trusted) == 0 || !isTrusted(peer) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			client := peer
+			hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+			for i := len(hops) - 1; i >= 0; i-- {
+				hop := strings.TrimSpace(hops[i])
+				if _, err := netip.ParseAddr(hop); err != nil {
+					break
+				}
+				client = hop
+				if !isTrusted(hop) {
+					break
+				}
+			}
+			ServeWithContext(next, w, r, context.WithValue(r.Context(), clientIPKey{}, client))
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package response
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestTrustProxies(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	tests := []struct {
+		name    string
+		trusted []netip.Prefix
+		peer    string
+		xff     []string
+		want    string
+	}{
+		{name: "no header", trusted: trusted, peer: "10.0.0.1:4000", want: "10.0.0.1"},
+		{name: "trusted peer", trusted: trusted, peer: "10.0.0.1:4000", xff: []string{"203.0.113.7"}, want: "203.0.113.7"},
+		{name: "untrusted peer", trusted: trusted, peer: "198.51.100.2:4000", xff: []string{"203.0.113.7"}, want: "198.51.100.2"},
+		{name: "nothing trusted", peer: "10.0.0.1:4000", xff: []string{"203.0.113.7"}, want: "10.0.0.1"},
+		{
+			name:    "client-supplied hops ignored",
+			trusted: trusted,
+			peer:    "10.0.0.1:4000",
+			xff:     []string{"1.2.3.4, 203.0.113.7"},
+			want:    "203.0.113.7",
+		},
+		{
+			name:    "chain of proxies",
+			trusted: trusted,
+			peer:    "10.0.0.1:4000",
+			xff:     []string{"1.2.3.4, 203.0.113.7", "10.0.0.9"},
+			want:    "203.0.113.7",
+		},
+		{name: "garbage hop", trusted: trusted, peer: "10.0.0.1:4000", xff: []string{"not-an-ip"}, want: "10.0.0.1"},
+		{name: "only proxies", trusted: trusted, peer: "10.0.0.1:4000", xff: []string{"10.0.0.5"}, want: "10.0.0.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			h := TrustProxies(tt.trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = ClientIP(r)
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.peer
+			for _, v := range tt.xff {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), req)
+			if got != tt.want {
+				t.Errorf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
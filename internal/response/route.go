@@ -0,0 +1,27 @@
+package response
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// Route returns the ServeMux pattern that matched r, without the method
+// prefix ("GET /api/chirps/{id}" becomes "/api/chirps/{id}"). It is empty
+// until the mux has routed the request, and for requests nothing matched.
+func Route(r *http.Request) string {
+	route := r.Pattern
+	if i := strings.IndexByte(route, ' '); i >= 0 {
+		route = route[i+1:]
+	}
+	return route
+}
+
+// ServeWithContext calls next with a copy of r carrying ctx, then copies the
+// pattern the mux set on that copy back onto r. Middleware that derives a
+// new request must use it, or everything further out loses the route.
+func ServeWithContext(next http.Handler, w http.ResponseWriter, r *http.Request, ctx context.Context) {
+	r2 := r.WithContext(ctx)
+	next.ServeHTTP(w, r2)
+	r.Pattern = r2.Pattern
+}
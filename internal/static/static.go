@@ -0,0 +1,231 @@
+package static
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"httpserv/internal/problem"
+)
+
+// ManifestName is served alongside the assets and maps every logical name
+// to its content-hashed name, e.g. "assets/logo.png" to
+// "assets/logo.3f9a1c2b.png".
+const ManifestName = "manifest.json"
+
+const (
+	// hashed names change whenever the content does, so they never need
+	// revalidating
+	immutableCache = "public, max-age=31536000, immutable"
+	// plain names must always be revalidated against the ETag
+	revalidateCache = "no-cache"
+)
+
+// encodings are the precompressed variants looked for next to each file,
+// in order of preference.
+var encodings = []struct {
+	name, ext string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+type variant struct {
+	encoding string
+	body     []byte
+	etag     string
+}
+
+type asset struct {
+	contentType string
+	cache       string
+	variants    []variant // identity encoding last
+}
+
+// Server serves a fixed set of files read once at startup. Directories
+// are never listed and no path segment may start with a dot, so .env,
+// .git and the like are unreachable even if they sit in the tree.
+type Server struct {
+	assets   map[string]*asset
+	manifest []byte
+	modTime  time.Time
+}
+
+// New indexes every regular file in fsys. Use os.DirFS for a directory on
+// disk or an embed.FS for assets compiled into the binary.
+func New(fsys fs.FS) (*Server, error) {
+	s := &Server{assets: make(map[string]*asset), modTime: time.Now()}
+	manifest := make(map[string]string)
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name != "." && hidden(name) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || isVariant(fsys, name) {
+			return nil
+		}
+
+		body, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(body)
+
+		a := &asset{contentType: mime.TypeByExtension(path.Ext(name)), cache: revalidateCache}
+		if a.contentType == "" {
+			a.contentType = http.DetectContentType(body)
+		}
+		for _, enc := range encodings {
+			if compressed, err := fs.ReadFile(fsys, name+enc.ext); err == nil {
+				a.variants = append(a.variants, variant{
+					encoding: enc.name,
+					body:     compressed,
+					etag:     etag(sum[:], enc.name),
+				})
+			}
+		}
+		a.variants = append(a.variants, variant{body: body, etag: etag(sum[:], "")})
+		s.assets[name] = a
+
+		hashed := hashedName(name, hex.EncodeToString(sum[:4]))
+		s.assets[hashed] = &asset{contentType: a.contentType, cache: immutableCache, variants: a.variants}
+		manifest[name] = hashed
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.manifest, err = json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Live serves fsys like New but reads it again on every request, so edits
+// show up without a restart. It rereads the whole tree each time and is
+// meant for working on the frontend, not for production.
+func Live(fsys fs.FS) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, err := New(fsys)
+		if err != nil {
+			problem.Internal(w, r, "failed to read static assets", err)
+			return
+		}
+		s.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" || strings.HasSuffix(r.URL.Path, "/") {
+		name = path.Join(name, "index.html")
+	}
+	if hidden(name) {
+		problem.Write(w, r, http.StatusNotFound, problem.NotFound, "file not found")
+		return
+	}
+
+	if name == ManifestName {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", revalidateCache)
+		http.ServeContent(w, r, name, s.modTime, bytes.NewReader(s.manifest))
+		return
+	}
+
+	a, ok := s.assets[name]
+	if !ok {
+		problem.Write(w, r, http.StatusNotFound, problem.NotFound, "file not found")
+		return
+	}
+
+	v := a.negotiate(r.Header.Get("Accept-Encoding"))
+	h := w.Header()
+	h.Set("Content-Type", a.contentType)
+	h.Set("Cache-Control", a.cache)
+	h.Set("ETag", v.etag)
+	h.Set("X-Content-Type-Options", "nosniff")
+	if len(a.variants) > 1 {
+		h.Add("Vary", "Accept-Encoding")
+	}
+	if v.encoding != "" {
+		h.Set("Content-Encoding", v.encoding)
+	}
+	http.ServeContent(w, r, name, s.modTime, bytes.NewReader(v.body))
+}
+
+// negotiate picks the first precompressed variant the client accepts,
+// falling back to the uncompressed file.
+func (a *asset) negotiate(acceptEncoding string) variant {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+				continue
+			}
+		}
+		accepted[strings.ToLower(strings.TrimSpace(coding))] = true
+	}
+	for _, v := range a.variants {
+		if v.encoding == "" || accepted[v.encoding] {
+			return v
+		}
+	}
+	return a.variants[len(a.variants)-1]
+}
+
+// isVariant reports whether name is a precompressed copy of another file,
+// which is only ever served in place of the original.
+func isVariant(fsys fs.FS, name string) bool {
+	for _, enc := range encodings {
+		if original, ok := strings.CutSuffix(name, enc.ext); ok {
+			if _, err := fs.Stat(fsys, original); err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hidden reports whether any segment of name is a dotfile or dot directory.
+func hidden(name string) bool {
+	for _, seg := range strings.Split(name, "/") {
+		if strings.HasPrefix(seg, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// hashedName inserts hash before the extension: a/b.css -> a/b.<hash>.css.
+func hashedName(name, hash string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+// etag is a strong validator over the uncompressed content. Each encoding
+// gets its own tag since the bytes on the wire differ.
+func etag(sum []byte, encoding string) string {
+	tag := base64.RawURLEncoding.EncodeToString(sum[:12])
+	if encoding != "" {
+		tag += "-" + encoding
+	}
+	return `"` + tag + `"`
+}
@@ -0,0 +1,222 @@
+package static
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"index.html":        {Data: []byte("<h1>home</h1>")},
+		"app.js":            {Data: []byte("console.log('app')")},
+		"app.js.br":         {Data: []byte("br-bytes")},
+		"app.js.gz":         {Data: []byte("gz-bytes")},
+		"docs/index.html":   {Data: []byte("<h1>docs</h1>")},
+		"docs/guide.txt":    {Data: []byte("read me")},
+		"empty/.keep":       {Data: []byte("")},
+		".env":              {Data: []byte("SECRET=1")},
+		".git/config":       {Data: []byte("[core]")},
+		"docs/.draft.txt":   {Data: []byte("unpublished")},
+		"assets/logo.svg":   {Data: []byte("<svg/>")},
+		"assets/.cache/tmp": {Data: []byte("tmp")},
+	}
+}
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	s, err := New(testFS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func get(s http.Handler, path string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.URL.Path = path
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestServerHidesAndLists(t *testing.T) {
+	s := newTestServer(t)
+	tests := []struct {
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{"/", http.StatusOK, "<h1>home</h1>"},
+		{"/index.html", http.StatusOK, "<h1>home</h1>"},
+		{"/docs/", http.StatusOK, "<h1>docs</h1>"},
+		{"/docs/guide.txt", http.StatusOK, "read me"},
+		{"/../index.html", http.StatusOK, "<h1>home</h1>"},
+		{"/docs/../app.js", http.StatusOK, "console.log('app')"},
+
+		{"/.env", http.StatusNotFound, ""},
+		{"/.git/config", http.StatusNotFound, ""},
+		{"/docs/.draft.txt", http.StatusNotFound, ""},
+		{"/assets/.cache/tmp", http.StatusNotFound, ""},
+		{"/docs/../.env", http.StatusNotFound, ""},
+		{"/../../.env", http.StatusNotFound, ""},
+		{"/empty/", http.StatusNotFound, ""},
+		{"/docs", http.StatusNotFound, ""},
+		{"/assets/", http.StatusNotFound, ""},
+		{"/missing.txt", http.StatusNotFound, ""},
+		// precompressed copies are only served in place of the original
+		{"/app.js.gz", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := get(s, tt.path)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if tt.wantCode == http.StatusOK && rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+			if tt.wantCode == http.StatusNotFound {
+				if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+					t.Errorf("Content-Type = %q, want a problem", ct)
+				}
+				if strings.Contains(rec.Body.String(), "SECRET") || strings.Contains(rec.Body.String(), "guide.txt") {
+					t.Errorf("404 body leaks content: %s", rec.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestServerManifestAndCaching(t *testing.T) {
+	s := newTestServer(t)
+
+	rec := get(s, "/"+ManifestName)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("manifest status = %d", rec.Code)
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != revalidateCache {
+		t.Errorf("manifest Cache-Control = %q, want %q", cc, revalidateCache)
+	}
+	var manifest map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := manifest[".env"]; ok {
+		t.Error("manifest lists a dotfile")
+	}
+	hashed, ok := manifest["assets/logo.svg"]
+	if !ok || !strings.HasPrefix(hashed, "assets/logo.") || !strings.HasSuffix(hashed, ".svg") || hashed == "assets/logo.svg" {
+		t.Fatalf("manifest[assets/logo.svg] = %q, want a content-hashed name", hashed)
+	}
+
+	plain := get(s, "/assets/logo.svg")
+	if cc := plain.Header().Get("Cache-Control"); cc != revalidateCache {
+		t.Errorf("plain name Cache-Control = %q, want %q", cc, revalidateCache)
+	}
+	immutable := get(s, "/"+hashed)
+	if immutable.Code != http.StatusOK || immutable.Body.String() != "<svg/>" {
+		t.Fatalf("hashed name: status %d body %q", immutable.Code, immutable.Body)
+	}
+	if cc := immutable.Header().Get("Cache-Control"); cc != immutableCache {
+		t.Errorf("hashed name Cache-Control = %q, want %q", cc, immutableCache)
+	}
+	if ct := immutable.Header().Get("Content-Type"); ct != "image/svg+xml" {
+		t.Errorf("Content-Type = %q, want image/svg+xml", ct)
+	}
+	if got := immutable.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+		t.Errorf("X-Content-Type-Options = %q, want nosniff", got)
+	}
+	if plain.Header().Get("ETag") != immutable.Header().Get("ETag") {
+		t.Error("plain and hashed names of one file have different ETags")
+	}
+}
+
+func TestServerETag(t *testing.T) {
+	s := newTestServer(t)
+	first := get(s, "/docs/guide.txt")
+	etag := first.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag")
+	}
+
+	rec := get(s, "/docs/guide.txt", "If-None-Match", etag)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("matching If-None-Match: status = %d, want 304", rec.Code)
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("304 has a body: %q", rec.Body)
+	}
+
+	rec = get(s, "/docs/guide.txt", "If-None-Match", `"something-else"`)
+	if rec.Code != http.StatusOK {
+		t.Errorf("stale If-None-Match: status = %d, want 200", rec.Code)
+	}
+}
+
+func TestServerEncodings(t *testing.T) {
+	s := newTestServer(t)
+	tests := []struct {
+		acceptEncoding string
+		wantEncoding   string
+		wantBody       string
+	}{
+		{"", "", "console.log('app')"},
+		{"gzip, deflate, br", "br", "br-bytes"},
+		{"gzip", "gzip", "gz-bytes"},
+		{"GZIP", "gzip", "gz-bytes"},
+		{"br;q=0, gzip", "gzip", "gz-bytes"},
+		{"br;q=0, gzip;q=0", "", "console.log('app')"},
+		{"br;q=0.5", "br", "br-bytes"},
+		{"identity", "", "console.log('app')"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.acceptEncoding, func(t *testing.T) {
+			rec := get(s, "/app.js", "Accept-Encoding", tt.acceptEncoding)
+			if got := rec.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Errorf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+			if rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body, tt.wantBody)
+			}
+			if got := rec.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Vary = %q, want Accept-Encoding", got)
+			}
+			if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/javascript") {
+				t.Errorf("Content-Type = %q, want the original file's type", ct)
+			}
+		})
+	}
+
+	// each encoding has its own validator, so a cached gzip body is never
+	// revalidated as the br one
+	br := get(s, "/app.js", "Accept-Encoding", "br").Header().Get("ETag")
+	gz := get(s, "/app.js", "Accept-Encoding", "gzip").Header().Get("ETag")
+	plain := get(s, "/app.js").Header().Get("ETag")
+	if br == gz || br == plain || gz == plain {
+		t.Errorf("ETags br %s, gzip %s, identity %s should all differ", br, gz, plain)
+	}
+
+	// a file without variants doesn't vary
+	if got := get(s, "/docs/guide.txt", "Accept-Encoding", "br").Header().Get("Vary"); got != "" {
+		t.Errorf("Vary = %q for a file with no variants", got)
+	}
+}
+
+func TestLive(t *testing.T) {
+	fsys := fstest.MapFS{"a.txt": {Data: []byte("one")}}
+	h := Live(fsys)
+	if got := get(h, "/a.txt").Body.String(); got != "one" {
+		t.Fatalf("body = %q, want one", got)
+	}
+	fsys["a.txt"] = &fstest.MapFile{Data: []byte("two")}
+	if got := get(h, "/a.txt").Body.String(); got != "two" {
+		t.Errorf("after edit body = %q, want two", got)
+	}
+}
@@ -0,0 +1,144 @@
+package throttle
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"httpserv/internal/database"
+)
+
+// Policy decides how quickly repeated failures on one key slow down and
+// then lock out further attempts. The zero Policy throttles nothing.
+type Policy struct {
+	// MaxFailures within Window locks the key for Lockout.
+	MaxFailures int
+	Lockout     time.Duration
+	// Below MaxFailures each failure blocks the next attempt for BaseDelay,
+	// doubling per failure up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Window is how long a quiet period must last before the count resets.
+	Window time.Duration
+}
+
+func (p Policy) enabled() bool {
+	return p.MaxFailures > 0
+}
+
+// delay is how long the key is blocked after its nth consecutive failure.
+func (p Policy) delay(failures int) time.Duration {
+	if failures >= p.MaxFailures {
+		return p.Lockout
+	}
+	d := p.BaseDelay
+	for i := 1; i < failures && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, p.MaxDelay)
+}
+
+// Login tracks failed logins per account and per client IP in Postgres, so
+// every replica sees the same counts. Accounts are keyed by the email that
+// was tried, whether or not it exists, so throttling doesn't reveal which
+// emails are registered. The email is stored hashed, which also bounds the
+// key length whatever was typed.
+type Login struct {
+	db      *database.Queries
+	account Policy
+	ip      Policy
+}
+
+func NewLogin(db *database.Queries, account, ip Policy) *Login {
+	return &Login{db: db, account: account, ip: ip}
+}
+
+func accountKey(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return "account:" + hex.EncodeToString(sum[:])
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Reserve counts an attempt to log in as email from ip before the password
+// is checked, so concurrent attempts can't all slip in ahead of the first
+// recorded failure. If either key is locked the attempt is refused and wait
+// says for how long. Otherwise penalty is the backoff already charged,
+// which stands if the attempt fails and is lifted by Succeed.
+func (l *Login) Reserve(ctx context.Context, email, ip string) (wait, penalty time.Duration, err error) {
+	// the IP first: attempts on a locked account still count against it
+	var ipPenalty time.Duration
+	if l.ip.enabled() {
+		wait, ipPenalty, err = l.reserve(ctx, ipKey(ip), l.ip)
+		if err != nil || wait > 0 {
+			return wait, 0, err
+		}
+	}
+	wait, accountPenalty, err := l.reserve(ctx, accountKey(email), l.account)
+	if err != nil || wait > 0 {
+		return wait, 0, err
+	}
+	return 0, max(ipPenalty, accountPenalty), nil
+}
+
+func (l *Login) reserve(ctx context.Context, key string, policy Policy) (wait, penalty time.Duration, err error) {
+	now := time.Now().UTC()
+	row, err := l.db.ReserveLoginAttempt(ctx, database.ReserveLoginAttemptParams{
+		Key:         key,
+		Now:         now,
+		WindowStart: now.Add(-policy.Window),
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	if row.LockedUntil.Valid && row.LockedUntil.Time.After(now) {
+		return row.LockedUntil.Time.Sub(now), 0, nil
+	}
+	// each concurrent attempt got its own count, so anything past the
+	// limit lost the race to the attempt that is setting the lock
+	if int(row.Failures) > policy.MaxFailures {
+		return policy.Lockout, 0, nil
+	}
+	penalty = policy.delay(int(row.Failures))
+	err = l.db.LockLogin(ctx, database.LockLoginParams{
+		Key:         key,
+		LockedUntil: sql.NullTime{Time: now.Add(penalty), Valid: true},
+	})
+	return 0, penalty, err
+}
+
+// Succeed clears the account's failures and gives the IP its attempt back.
+// The IP's earlier failures are left to decay, otherwise logging into one
+// account of your own between guesses would reset them.
+func (l *Login) Succeed(ctx context.Context, email, ip string) error {
+	if err := l.db.ClearLoginThrottle(ctx, accountKey(email)); err != nil {
+		return err
+	}
+	if !l.ip.enabled() {
+		return nil
+	}
+	return l.db.RefundLoginAttempt(ctx, database.RefundLoginAttemptParams{
+		Key:         ipKey(ip),
+		MaxFailures: int32(l.ip.MaxFailures),
+	})
+}
+
+// Unlock lifts a lockout on an account before it expires.
+func (l *Login) Unlock(ctx context.Context, email string) error {
+	return l.db.ClearLoginThrottle(ctx, accountKey(email))
+}
+
+// Purge deletes the rows that no longer affect anything: last failure
+// outside both windows and no lock still running. It returns how many went.
+func (l *Login) Purge(ctx context.Context) (int64, error) {
+	now := time.Now().UTC()
+	return l.db.PurgeLoginThrottles(ctx, database.PurgeLoginThrottlesParams{
+		WindowStart: now.Add(-max(l.account.Window, l.ip.Window)),
+		Now:         now,
+	})
+}
@@ -1,66 +1,161 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"flag"
 	hash "httpserv/internal/auth"
+	"httpserv/internal/config"
+	"httpserv/internal/content"
 	"httpserv/internal/database"
+	"httpserv/internal/health"
+	"httpserv/internal/logging"
+	"httpserv/internal/metrics"
+	"httpserv/internal/migrate"
+	"httpserv/internal/problem"
+	"httpserv/internal/requestid"
+	"httpserv/internal/response"
+	"httpserv/internal/static"
+	"httpserv/internal/throttle"
+	"httpserv/internal/tracing"
+	"httpserv/web"
+	"io/fs"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
-	"sync/atomic"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type apiConfig struct {
-	fileserverHits atomic.Int32
-	dbQueries      *database.Queries
-	PLATFORM       string
-	JWTstring      string
+	db        *sql.DB
+	dbQueries *database.Queries
+	PLATFORM  string
+	jwtKeys   *hash.KeySet
+	metrics   *metrics.Metrics
+	polkaKey  string
+	filter    *content.Filter
+	limits    content.Limits
+	logins    *throttle.Login
+	passwords *hash.PasswordHasher
+	pwpolicy  hash.PasswordPolicy
 }
 
-func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cfg.fileserverHits.Add(1)
-		next.ServeHTTP(w, r)
-	})
+func (cfg *apiConfig) resetHandler(w http.ResponseWriter, r *http.Request) {
+	if cfg.PLATFORM != "dev" {
+		problem.Write(w, r, http.StatusForbidden, problem.Forbidden, "reset is only available on the dev platform")
+		return
+	}
+	err := cfg.dbQueries.DeleteUsers(r.Context())
+	if err != nil {
+		problem.Internal(w, r, "delete users", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"success": "all users deleted."})
+
 }
 
-func (cfg *apiConfig) metricsHandler(w http.ResponseWriter, r *http.Request) {
-	hits := cfg.fileserverHits.Load()
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.Write([]byte("<html><body><h1>Welcome, Chirpy Admin</h1><p>Chirpy has been visited " + strconv.Itoa(int(hits)) + " times!</p></body></html>"))
+type RoleChange struct {
+	Role string `json:"role"`
 }
 
-func (cfg *apiConfig) resetHandler(w http.ResponseWriter, r *http.Request) {
-	cfg.fileserverHits.Store(0)
+func (cfg *apiConfig) setrole(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
 
-	if cfg.PLATFORM != "dev" {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+	userid, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidParam, "user id must be a UUID")
+		return
+	}
+	var change RoleChange
+	if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, "request body is not valid JSON")
+		return
+	}
+	role, ok := hash.ParseRole(change.Role)
+	if !ok {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, "role must be user, moderator or admin")
+		return
+	}
+	// demoting yourself could leave nobody able to undo it
+	if self, _ := hash.UserIDFromContext(r.Context()); self == userid && role != hash.RoleAdmin {
+		problem.Write(w, r, http.StatusConflict, problem.Conflict, "admins cannot demote themselves")
+		return
+	}
+
+	user, err := cfg.dbQueries.SetUserRole(r.Context(), database.SetUserRoleParams{
+		ID:   userid,
+		Role: string(role),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Write(w, r, http.StatusNotFound, problem.NotFound, "user not found")
 		return
 	}
-	err := cfg.dbQueries.DeleteUsers(r.Context())
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to delete user", "details": err.Error()})
+		problem.Internal(w, r, "set user role", err)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"success": "all users deleted.", "reset": "Hits reset to 0"})
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":            user.ID,
+		"created_at":    user.CreatedAt,
+		"updated_at":    user.UpdatedAt,
+		"email":         user.Email,
+		"role":          user.Role,
+		"is_chirpy_red": user.IsChirpyRed,
+	})
+}
 
+// unlockuser lifts a login lockout on an account before it expires.
+func (cfg *apiConfig) unlockuser(w http.ResponseWriter, r *http.Request) {
+	userid, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidParam, "user id must be a UUID")
+		return
+	}
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), userid)
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Write(w, r, http.StatusNotFound, problem.NotFound, "user not found")
+		return
+	}
+	if err != nil {
+		problem.Internal(w, r, "get user", err)
+		return
+	}
+	if err := cfg.logins.Unlock(r.Context(), user.Email); err != nil {
+		problem.Internal(w, r, "unlock user", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func readinessHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+func (cfg *apiConfig) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
+	json.NewEncoder(w).Encode(cfg.jwtKeys.JWKS())
+}
+
+// isUniqueViolation reports whether err is Postgres rejecting a duplicate
+// value, e.g. a second account with the same email.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
 }
 
 type Email struct {
@@ -68,21 +163,44 @@ type Email struct {
 	Password string `json:"password"`
 }
 
+// validCredentials checks the email and, if checkPassword is set, the
+// password policy, writing a field error response and returning false if
+// anything fails.
+func (cfg *apiConfig) validCredentials(w http.ResponseWriter, r *http.Request, creds Email, checkPassword bool) bool {
+	var errs []problem.FieldError
+	if !strings.Contains(creds.Emailid, "@") {
+		errs = append(errs, problem.FieldError{Field: "email", Code: "invalid", Message: "email must be an email address"})
+	}
+	if checkPassword {
+		pwerrs, err := cfg.pwpolicy.Check(r.Context(), creds.Password, creds.Emailid)
+		if err != nil {
+			problem.Internal(w, r, "check password policy", err)
+			return false
+		}
+		errs = append(errs, pwerrs...)
+	}
+	if len(errs) > 0 {
+		problem.WriteFields(w, r, errs)
+		return false
+	}
+	return true
+}
+
 func (cfg *apiConfig) apiuser(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
 	var userstruct Email
 	if err := json.NewDecoder(r.Body).Decode(&userstruct); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, "request body is not valid JSON")
+		return
+	}
+	if !cfg.validCredentials(w, r, userstruct, true) {
 		return
 	}
 	// email stored
-	hashedpass, err := hash.HashPassword(userstruct.Password)
+	hashedpass, err := cfg.passwords.Hash(r.Context(), userstruct.Password)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to hash pass", "details": err.Error()})
+		problem.Internal(w, r, "hash password", err)
 		return
 	}
 
@@ -91,170 +209,569 @@ func (cfg *apiConfig) apiuser(w http.ResponseWriter, r *http.Request) {
 		HashedPassword: hashedpass,
 	})
 
+	if isUniqueViolation(err) {
+		problem.Write(w, r, http.StatusConflict, problem.Conflict, "email is already registered")
+		return
+	}
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create user", "details": err.Error()})
+		problem.Internal(w, r, "create user", err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"id":         user.ID,
-		"created_at": user.CreatedAt,
-		"updated_at": user.UpdatedAt,
-		"email":      user.Email,
+		"id":            user.ID,
+		"created_at":    user.CreatedAt,
+		"updated_at":    user.UpdatedAt,
+		"email":         user.Email,
+		"role":          user.Role,
+		"is_chirpy_red": user.IsChirpyRed,
 	})
 
 }
 
+func (cfg *apiConfig) updateuser(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	jwtuuid, ok := hash.UserIDFromContext(r.Context())
+	if !ok {
+		hash.WriteUnauthorized(w, r, "invalid_token", "no authenticated user")
+		return
+	}
+
+	var userstruct Email
+	if err := json.NewDecoder(r.Body).Decode(&userstruct); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, "request body is not valid JSON")
+		return
+	}
+
+	current, err := cfg.dbQueries.GetUserByID(r.Context(), jwtuuid)
+	if err != nil {
+		hash.WriteUnauthorized(w, r, "invalid_token", "user no longer exists")
+		return
+	}
+	// a mismatch against the old hash means the password is being rotated
+	pwchanged := cfg.passwords.Check(r.Context(), userstruct.Password, current.HashedPassword) != nil
+	// an unchanged password was accepted once already, so only new ones
+	// have to meet the current policy
+	if !cfg.validCredentials(w, r, userstruct, pwchanged) {
+		return
+	}
+
+	hashedpass, err := cfg.passwords.Hash(r.Context(), userstruct.Password)
+	if err != nil {
+		problem.Internal(w, r, "hash password", err)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		problem.Internal(w, r, "update user", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := database.New(tracing.WrapDB(tx))
+
+	user, err := qtx.UpdateUser(r.Context(), database.UpdateUserParams{
+		ID:             jwtuuid,
+		Email:          userstruct.Emailid,
+		HashedPassword: hashedpass,
+	})
+	if isUniqueViolation(err) {
+		problem.Write(w, r, http.StatusConflict, problem.Conflict, "email is already registered")
+		return
+	}
+	if err != nil {
+		problem.Internal(w, r, "update user", err)
+		return
+	}
+
+	// a password change logs out every session, this one included: the
+	// request carries only an access token, so there's no refresh token
+	// to tell apart and spare, and the client must log in again once it
+	// expires
+	if pwchanged {
+		if err := qtx.RevokeAllUserRTokens(r.Context(), user.ID); err != nil {
+			problem.Internal(w, r, "revoke refresh tokens", err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		problem.Internal(w, r, "update user", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":            user.ID,
+		"created_at":    user.CreatedAt,
+		"updated_at":    user.UpdatedAt,
+		"email":         user.Email,
+		"role":          user.Role,
+		"is_chirpy_red": user.IsChirpyRed,
+	})
+}
+
 type Chirp struct {
 	Body    string    `json:"body"`
 	User_id uuid.UUID `json:"user_id"`
 }
 
+// checkedChirp is a chirp body after cleaning, measured against the
+// author's limit.
+type checkedChirp struct {
+	Cleaned   string
+	Length    int
+	Limit     int
+	Remaining int
+}
+
+// checkChirp runs the same cleaning and counting for posting and for the
+// dry run, so the two can never disagree.
+func (cfg *apiConfig) checkChirp(author database.User, body string) checkedChirp {
+	// the limit applies to what will be stored, not what was sent
+	cleaned := cfg.filter.Clean(body)
+	length := cfg.limits.Length(cleaned)
+	limit := cfg.limits.Max(author.IsChirpyRed)
+	return checkedChirp{
+		Cleaned:   cleaned,
+		Length:    length,
+		Limit:     limit,
+		Remaining: limit - length,
+	}
+}
+
 func (cfg *apiConfig) post(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	var chirp Chirp
 	if err := json.NewDecoder(r.Body).Decode(&chirp); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body", "details": err.Error()})
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, "request body is not valid JSON")
 		return
 	}
-	bearertoken, err := hash.GetBearerToken(r.Header)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid parsing header", "details": err.Error()})
+	jwtuuid, ok := hash.UserIDFromContext(r.Context())
+	if !ok {
+		hash.WriteUnauthorized(w, r, "invalid_token", "no authenticated user")
 		return
 	}
-
-	jwtuuid, err := hash.ValidateJWT(bearertoken, cfg.JWTstring)
+	author, err := cfg.dbQueries.GetUserByID(r.Context(), jwtuuid)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "invalid jwt", "details": err.Error()})
+		hash.WriteUnauthorized(w, r, "invalid_token", "user no longer exists")
 		return
 	}
-	if len(chirp.Body) > 140 {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Chirp is too long"})
+	checked := cfg.checkChirp(author, chirp.Body)
+	if checked.Cleaned == "" {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, "chirp is empty")
+		return
+	}
+	if checked.Remaining < 0 {
+		problem.Write(w, r, http.StatusBadRequest, problem.ChirpTooLong,
+			"chirp is "+strconv.Itoa(checked.Length)+" characters, the limit is "+strconv.Itoa(checked.Limit))
 		return
 	}
-
-	w.Header().Set("Content-Type", "application/json")
 
 	post, err := cfg.dbQueries.CreateChirp(r.Context(), database.CreateChirpParams{
-		Body:   chirp.Body,
+		Body:   checked.Cleaned,
 		UserID: jwtuuid,
 	})
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "error making db request,", "details": err.Error()})
+		problem.Internal(w, r, "create chirp", err)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"id":         post.ID,
-		"created_at": post.CreatedAt,
-		"updated_at": post.UpdatedAt,
-		"body":       post.Body,
-		"user_id":    post.UserID,
+		"id":           post.ID,
+		"created_at":   post.CreatedAt,
+		"updated_at":   post.UpdatedAt,
+		"body":         post.Body,
+		"cleaned_body": post.Body,
+		"user_id":      post.UserID,
+		"length":       checked.Length,
+		"remaining":    checked.Remaining,
+	})
+}
+
+// validatechirp is a dry run of post: it cleans and measures the body
+// against the caller's limit without storing anything.
+func (cfg *apiConfig) validatechirp(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var chirp Chirp
+	if err := json.NewDecoder(r.Body).Decode(&chirp); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, "request body is not valid JSON")
+		return
+	}
+	jwtuuid, ok := hash.UserIDFromContext(r.Context())
+	if !ok {
+		hash.WriteUnauthorized(w, r, "invalid_token", "no authenticated user")
+		return
+	}
+	author, err := cfg.dbQueries.GetUserByID(r.Context(), jwtuuid)
+	if err != nil {
+		hash.WriteUnauthorized(w, r, "invalid_token", "user no longer exists")
+		return
+	}
+	checked := cfg.checkChirp(author, chirp.Body)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"valid":        checked.Cleaned != "" && checked.Remaining >= 0,
+		"cleaned_body": checked.Cleaned,
+		"length":       checked.Length,
+		"limit":        checked.Limit,
+		"remaining":    checked.Remaining,
+	})
+}
+
+func (cfg *apiConfig) reloadcontent(w http.ResponseWriter, r *http.Request) {
+	if err := cfg.filter.Reload(); err != nil {
+		problem.Internal(w, r, "reload banned words", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"banned_words": cfg.filter.Len(),
 	})
 }
 
+const (
+	defaultChirpPageSize = 50
+	maxChirpPageSize     = 100
+)
+
+// chirpCursor is where the next page starts, plus the query it belongs to:
+// a cursor only means something under the same sort and author_id.
+type chirpCursor struct {
+	Sort      string
+	AuthorID  uuid.NullUUID
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// encodeCursor turns a chirpCursor into an opaque token the client hands
+// back as ?cursor=.
+func encodeCursor(c chirpCursor) string {
+	var author string
+	if c.AuthorID.Valid {
+		author = c.AuthorID.UUID.String()
+	}
+	raw := c.Sort + "|" + author + "|" + c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (chirpCursor, error) {
+	malformed := errors.New("malformed cursor")
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return chirpCursor{}, malformed
+	}
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 4 {
+		return chirpCursor{}, malformed
+	}
+	c := chirpCursor{Sort: parts[0]}
+	if c.Sort != "asc" && c.Sort != "desc" {
+		return chirpCursor{}, malformed
+	}
+	if parts[1] != "" {
+		author, err := uuid.Parse(parts[1])
+		if err != nil {
+			return chirpCursor{}, malformed
+		}
+		c.AuthorID = uuid.NullUUID{UUID: author, Valid: true}
+	}
+	if c.CreatedAt, err = time.Parse(time.RFC3339Nano, parts[2]); err != nil {
+		return chirpCursor{}, malformed
+	}
+	if c.ID, err = uuid.Parse(parts[3]); err != nil {
+		return chirpCursor{}, malformed
+	}
+	return c, nil
+}
+
 func (cfg *apiConfig) getchirps(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
-	posts, err := cfg.dbQueries.GetAllChirps(r.Context())
+	query := r.URL.Query()
+
+	var authorID uuid.NullUUID
+	if s := query.Get("author_id"); s != "" {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.InvalidParam, "author_id must be a UUID")
+			return
+		}
+		authorID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	sortDir := query.Get("sort")
+	if sortDir == "" {
+		sortDir = "asc"
+	}
+	if sortDir != "asc" && sortDir != "desc" {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidParam, "sort must be asc or desc")
+		return
+	}
+
+	limit := defaultChirpPageSize
+	if s := query.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxChirpPageSize {
+			problem.Write(w, r, http.StatusBadRequest, problem.InvalidParam, "limit must be between 1 and "+strconv.Itoa(maxChirpPageSize))
+			return
+		}
+		limit = n
+	}
+
+	var afterCreatedAt sql.NullTime
+	var afterID uuid.NullUUID
+	if s := query.Get("cursor"); s != "" {
+		c, err := decodeCursor(s)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.InvalidParam, "cursor is malformed")
+			return
+		}
+		// paging on with a different sort or author would skip or repeat chirps
+		if c.Sort != sortDir || c.AuthorID != authorID {
+			problem.Write(w, r, http.StatusBadRequest, problem.InvalidParam, "cursor does not match sort and author_id")
+			return
+		}
+		afterCreatedAt = sql.NullTime{Time: c.CreatedAt, Valid: true}
+		afterID = uuid.NullUUID{UUID: c.ID, Valid: true}
+	}
+
+	// fetch one extra row to find out whether there is another page
+	var posts []database.Post
+	var err error
+	if sortDir == "desc" {
+		posts, err = cfg.dbQueries.ListChirpsDesc(r.Context(), database.ListChirpsDescParams{
+			AuthorID:       authorID,
+			AfterCreatedAt: afterCreatedAt,
+			AfterID:        afterID,
+			Limit:          int32(limit + 1),
+		})
+	} else {
+		posts, err = cfg.dbQueries.ListChirpsAsc(r.Context(), database.ListChirpsAscParams{
+			AuthorID:       authorID,
+			AfterCreatedAt: afterCreatedAt,
+			AfterID:        afterID,
+			Limit:          int32(limit + 1),
+		})
+	}
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "error fetching,", "details": err.Error()})
+		problem.Internal(w, r, "list chirps", err)
+		return
+	}
+
+	var nextCursor string
+	if len(posts) > limit {
+		posts = posts[:limit]
+		last := posts[len(posts)-1]
+		nextCursor = encodeCursor(chirpCursor{Sort: sortDir, AuthorID: authorID, CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+
+	chirps := make([]map[string]interface{}, 0, len(posts))
+	for _, post := range posts {
+		chirps = append(chirps, map[string]interface{}{
+			"id":         post.ID,
+			"created_at": post.CreatedAt,
+			"updated_at": post.UpdatedAt,
+			"body":       post.Body,
+			"user_id":    post.UserID,
+		})
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(posts)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"chirps":      chirps,
+		"next_cursor": nextCursor,
+	})
 }
 
 func (cfg *apiConfig) specchirps(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id") // Extracts `{id}` from the pat
 	uuid, err := uuid.Parse(id)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid UUID format", "details": err.Error()})
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidParam, "chirp id must be a UUID")
 		return
 	}
 
 	post, err := cfg.dbQueries.GetPost(r.Context(), uuid)
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Write(w, r, http.StatusNotFound, problem.NotFound, "chirp not found")
+		return
+	}
 	if err != nil {
-		json.NewEncoder(w).Encode(map[string]string{"error": "error getting id,", "details": err.Error()})
+		problem.Internal(w, r, "get chirp", err)
+		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(post)
 }
 
+func (cfg *apiConfig) deletechirp(w http.ResponseWriter, r *http.Request) {
+	jwtuuid, ok := hash.UserIDFromContext(r.Context())
+	if !ok {
+		hash.WriteUnauthorized(w, r, "invalid_token", "no authenticated user")
+		return
+	}
+
+	chirpid, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidParam, "chirp id must be a UUID")
+		return
+	}
+
+	post, err := cfg.dbQueries.GetPost(r.Context(), chirpid)
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Write(w, r, http.StatusNotFound, problem.NotFound, "chirp not found")
+		return
+	}
+	if err != nil {
+		problem.Internal(w, r, "get chirp", err)
+		return
+	}
+
+	// only the author or a moderator may delete a chirp
+	role, _ := hash.RoleFromContext(r.Context())
+	if post.UserID != jwtuuid && !role.AtLeast(hash.RoleModerator) {
+		problem.Write(w, r, http.StatusForbidden, problem.Forbidden, "you can only delete your own chirps")
+		return
+	}
+
+	if err := cfg.dbQueries.DeleteChirp(r.Context(), post.ID); err != nil {
+		problem.Internal(w, r, "delete chirp", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 type Loginreq struct {
 	Emailid  string `json:"email"`
 	Password string `json:"password"`
 }
 
+// loginFailed sends the one 401 every kind of login failure shares, with
+// Retry-After once backoff kicks in. The attempt was already counted when
+// it was reserved, and penalty is the backoff that charged.
+func (cfg *apiConfig) loginFailed(w http.ResponseWriter, r *http.Request, penalty time.Duration) {
+	cfg.metrics.AuthEvent(metrics.EventLogin, metrics.OutcomeFailure)
+	if penalty > 0 {
+		setRetryAfter(w, penalty)
+	}
+	problem.Write(w, r, http.StatusUnauthorized, problem.InvalidLogin, "incorrect email or password")
+}
+
+func (cfg *apiConfig) rehashPassword(r *http.Request, user database.User, password string) {
+	logger := logging.FromContext(r.Context())
+	newHash, err := cfg.passwords.Hash(r.Context(), password)
+	if err != nil {
+		logger.Warn("rehash password", "error", err)
+		return
+	}
+	_, err = cfg.dbQueries.RehashPassword(r.Context(), database.RehashPasswordParams{
+		ID:      user.ID,
+		OldHash: user.HashedPassword,
+		NewHash: newHash,
+	})
+	if err != nil {
+		logger.Warn("store rehashed password", "error", err)
+	}
+}
+
+// setRetryAfter sets Retry-After in whole seconds, rounding up so clients
+// never retry early.
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+}
+
 func (cfg *apiConfig) apilogin(w http.ResponseWriter, r *http.Request) {
 	var login Loginreq
 	if err := json.NewDecoder(r.Body).Decode(&login); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body", "details": err.Error()})
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, "request body is not valid JSON")
 		return
 	}
+	// count the attempt before hashing, so a locked account costs nothing
+	// and parallel guesses can't all get in ahead of the first failure
+	clientIP := response.ClientIP(r)
+	wait, penalty, err := cfg.logins.Reserve(r.Context(), login.Emailid, clientIP)
+	if err != nil {
+		problem.Internal(w, r, "reserve login attempt", err)
+		return
+	}
+	if wait > 0 {
+		cfg.metrics.AuthEvent(metrics.EventLogin, metrics.OutcomeLocked)
+		setRetryAfter(w, wait)
+		problem.Write(w, r, http.StatusTooManyRequests, problem.TooManyLogins, "too many failed login attempts, try again later")
+		return
+	}
+
 	user, err := cfg.dbQueries.GetPwByEmail(r.Context(), login.Emailid)
+	if errors.Is(err, sql.ErrNoRows) {
+		// burn the same hashing time as a wrong password and fail the same
+		// way, so neither timing nor the response shows the email is unknown
+		cfg.passwords.CheckNoUser(r.Context(), login.Password)
+		if r.Context().Err() != nil {
+			// the client gave up waiting for a hashing slot
+			return
+		}
+		cfg.loginFailed(w, r, penalty)
+		return
+	}
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"error": "idk", "details": err.Error()})
+		problem.Internal(w, r, "get user by email", err)
+		return
+	}
+	err = cfg.passwords.Check(r.Context(), login.Password, user.HashedPassword)
+	if r.Context().Err() != nil {
 		return
 	}
-	err = hash.CheckPasswordHash(login.Password, user.HashedPassword)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(map[string]string{"error": "wrongff pw buiddy", "details": err.Error()})
+		cfg.loginFailed(w, r, penalty)
 		return
 	}
+	// upgrade hashes made with an older scheme or cost while we have the
+	// plaintext; a failure here shouldn't stop the login
+	if cfg.passwords.NeedsRehash(user.HashedPassword) {
+		cfg.rehashPassword(r, user, login.Password)
+	}
 	// here now they have successsfully lloggedin
+	if err := cfg.logins.Succeed(r.Context(), login.Emailid, clientIP); err != nil {
+		problem.Internal(w, r, "clear login throttle", err)
+		return
+	}
 
-	jwtmade, err := hash.MakeJWT(user.ID, cfg.JWTstring, 3600*time.Second)
+	jwtmade, err := cfg.jwtKeys.MakeJWT(user.ID, hash.Role(user.Role), 3600*time.Second)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create JWT", "details": err.Error()})
+		problem.Internal(w, r, "create JWT", err)
 		return
 	}
 
 	refreshmade, err := hash.MakeRefreshToken()
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to make refresh token", "details": err.Error()})
+		problem.Internal(w, r, "make refresh token", err)
 		return
 	}
 	expires := time.Now().Add(60 * 24 * time.Hour)
-	rtoken, err := cfg.dbQueries.NewRToken(r.Context(), database.NewRTokenParams{
-		Token:     refreshmade,
+	_, err = cfg.dbQueries.NewRToken(r.Context(), database.NewRTokenParams{
+		TokenHash: hash.HashRefreshToken(refreshmade),
 		UserID:    user.ID,
 		ExpiresAt: expires,
+		FamilyID:  uuid.New(),
 	})
 
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create user", "details": err.Error()})
+		problem.Internal(w, r, "store refresh token", err)
 		return
 	}
 
+	cfg.metrics.AuthEvent(metrics.EventLogin, metrics.OutcomeSuccess)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -262,110 +779,564 @@ func (cfg *apiConfig) apilogin(w http.ResponseWriter, r *http.Request) {
 		"created_at":    user.CreatedAt,
 		"updated_at":    user.UpdatedAt,
 		"email":         user.Email,
+		"role":          user.Role,
+		"is_chirpy_red": user.IsChirpyRed,
 		"token":         jwtmade,
-		"refresh_token": rtoken.Token,
+		"refresh_token": refreshmade,
 	})
 }
 
 func (cfg *apiConfig) apirefresh(w http.ResponseWriter, r *http.Request) {
 	bearerToken, err := hash.GetBearerToken(r.Header)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid parsing header", "details": err.Error()})
+		cfg.metrics.AuthEvent(metrics.EventRefresh, metrics.OutcomeFailure)
+		hash.WriteUnauthorized(w, r, hash.ChallengeCode(err), err.Error())
+		return
+	}
+
+	rtoken, err := cfg.dbQueries.GetRToken(r.Context(), hash.HashRefreshToken(bearerToken))
+	if err != nil {
+		cfg.metrics.AuthEvent(metrics.EventRefresh, metrics.OutcomeFailure)
+		hash.WriteUnauthorized(w, r, "invalid_token", "invalid or expired refresh token")
+		return
+	}
+
+	// a token that was already rotated is being replayed, so whoever holds
+	// it may not be the user: kill the whole chain
+	if rtoken.ReplacedBy.Valid {
+		if err := cfg.dbQueries.RevokeRTokenFamily(r.Context(), rtoken.FamilyID); err != nil {
+			problem.Internal(w, r, "revoke token family", err)
+			return
+		}
+		cfg.metrics.AuthEvent(metrics.EventRefresh, metrics.OutcomeReuse)
+		hash.WriteUnauthorized(w, r, "invalid_token", "refresh token reuse detected")
+		return
+	}
+
+	if rtoken.ExpiresAt.Before(time.Now()) || rtoken.RevokedAt.Valid {
+		cfg.metrics.AuthEvent(metrics.EventRefresh, metrics.OutcomeFailure)
+		hash.WriteUnauthorized(w, r, "invalid_token", "invalid or expired refresh token")
+		return
+	}
+
+	refreshmade, err := hash.MakeRefreshToken()
+	if err != nil {
+		problem.Internal(w, r, "make refresh token", err)
 		return
 	}
 
-	rtoken, err := cfg.dbQueries.GetRToken(r.Context(), bearerToken)
-	if err != nil || rtoken.ExpiresAt.Before(time.Now()) || rtoken.RevokedAt.Valid {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid or expired refresh token", "details": err.Error()})
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		problem.Internal(w, r, "rotate refresh token", err)
 		return
 	}
+	defer tx.Rollback()
+	qtx := database.New(tracing.WrapDB(tx))
 
-	jwtmade, err := hash.MakeJWT(rtoken.UserID, cfg.JWTstring, 3600*time.Second)
+	newtoken, err := qtx.NewRToken(r.Context(), database.NewRTokenParams{
+		TokenHash: hash.HashRefreshToken(refreshmade),
+		UserID:    rtoken.UserID,
+		ExpiresAt: time.Now().Add(60 * 24 * time.Hour),
+		FamilyID:  rtoken.FamilyID,
+	})
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create JWT", "details": err.Error()})
+		problem.Internal(w, r, "rotate refresh token", err)
 		return
 	}
 
+	// the update only matches while the old token is still live, so losing
+	// a race against a concurrent refresh counts as reuse too
+	_, err = qtx.RotateRToken(r.Context(), database.RotateRTokenParams{
+		TokenHash:  rtoken.TokenHash,
+		ReplacedBy: sql.NullString{String: newtoken.TokenHash, Valid: true},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		tx.Rollback()
+		if err := cfg.dbQueries.RevokeRTokenFamily(r.Context(), rtoken.FamilyID); err != nil {
+			problem.Internal(w, r, "revoke token family", err)
+			return
+		}
+		cfg.metrics.AuthEvent(metrics.EventRefresh, metrics.OutcomeReuse)
+		hash.WriteUnauthorized(w, r, "invalid_token", "refresh token reuse detected")
+		return
+	}
+	if err != nil {
+		problem.Internal(w, r, "rotate refresh token", err)
+		return
+	}
+
+	// read the role afresh so promotions and demotions apply on refresh
+	user, err := qtx.GetUserByID(r.Context(), rtoken.UserID)
+	if err != nil {
+		problem.Internal(w, r, "get user", err)
+		return
+	}
+	jwtmade, err := cfg.jwtKeys.MakeJWT(user.ID, hash.Role(user.Role), 3600*time.Second)
+	if err != nil {
+		problem.Internal(w, r, "create JWT", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		problem.Internal(w, r, "rotate refresh token", err)
+		return
+	}
+
+	cfg.metrics.AuthEvent(metrics.EventRefresh, metrics.OutcomeSuccess)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"token": jwtmade,
+		"token":         jwtmade,
+		"refresh_token": refreshmade,
 	})
 }
 
 func (cfg *apiConfig) apirevoke(w http.ResponseWriter, r *http.Request) {
 	bearerToken, err := hash.GetBearerToken(r.Header)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid parsing header", "details": err.Error()})
+		hash.WriteUnauthorized(w, r, hash.ChallengeCode(err), err.Error())
 		return
 	}
 
 	err = cfg.dbQueries.RevokeRToken(r.Context(), database.RevokeRTokenParams{
-		Token:     bearerToken,
+		TokenHash: hash.HashRefreshToken(bearerToken),
 		RevokedAt: sql.NullTime{Time: time.Now(), Valid: true},
 		UpdatedAt: time.Now(),
 	})
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to revoke token", "details": err.Error()})
+		cfg.metrics.AuthEvent(metrics.EventRevoke, metrics.OutcomeFailure)
+		problem.Internal(w, r, "revoke refresh token", err)
+		return
+	}
+
+	cfg.metrics.AuthEvent(metrics.EventRevoke, metrics.OutcomeSuccess)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Polka webhook events we act on; anything else is acknowledged and
+// ignored so the provider stops retrying it.
+const (
+	polkaUserUpgraded   = "user.upgraded"
+	polkaUserDowngraded = "user.downgraded"
+)
+
+type PolkaEvent struct {
+	Event string `json:"event"`
+	Data  struct {
+		UserID uuid.UUID `json:"user_id"`
+	} `json:"data"`
+}
+
+func (cfg *apiConfig) polkawebhook(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	key, err := hash.GetAPIKey(r.Header)
+	if err == nil && (cfg.polkaKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(cfg.polkaKey)) != 1) {
+		err = errors.New("invalid API key")
+	}
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `ApiKey realm="chirpy"`)
+		problem.Write(w, r, http.StatusUnauthorized, problem.Unauthorized, err.Error())
+		return
+	}
+
+	var event PolkaEvent
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, "request body is not valid JSON")
+		return
+	}
+
+	var red bool
+	switch event.Event {
+	case polkaUserUpgraded:
+		red = true
+	case polkaUserDowngraded:
+		red = false
+	default:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// setting the flag to the value it already has is a no-op, so
+	// redelivered events are safe
+	n, err := cfg.dbQueries.SetChirpyRed(r.Context(), database.SetChirpyRedParams{
+		ID:          event.Data.UserID,
+		IsChirpyRed: red,
+	})
+	if err != nil {
+		problem.Internal(w, r, "set chirpy red", err)
+		return
+	}
+	if n == 0 {
+		problem.Write(w, r, http.StatusNotFound, problem.NotFound, "user not found")
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// newPasswordHasher hashes with the configured scheme and verifies both, so
+// switching schemes never locks anyone out.
+func newPasswordHasher(cfg config.Password) (*hash.PasswordHasher, error) {
+	argon := hash.NewArgon2id(hash.Argon2Params{
+		Memory:  uint32(cfg.Argon2Memory),
+		Time:    uint32(cfg.Argon2Time),
+		Threads: uint8(cfg.Argon2Threads),
+		SaltLen: hash.DefaultArgon2Params.SaltLen,
+		KeyLen:  hash.DefaultArgon2Params.KeyLen,
+	})
+	bcrypt := hash.NewBcrypt(cfg.BcryptCost)
+	if cfg.Scheme == "bcrypt" {
+		return hash.NewPasswordHasher(bcrypt, argon)
+	}
+	return hash.NewPasswordHasher(argon, bcrypt)
+}
+
+func newPasswordPolicy(cfg config.Password) (hash.PasswordPolicy, error) {
+	policy := hash.PasswordPolicy{MinLength: cfg.MinLength, MaxBytes: cfg.MaxBytes}
+	if cfg.Scheme == "bcrypt" {
+		policy.MaxBytes = min(policy.MaxBytes, hash.BcryptMaxBytes)
+	}
+	if cfg.BreachedDir != "" {
+		ranges, err := hash.OpenBreachRanges(cfg.BreachedDir)
+		if err != nil {
+			return hash.PasswordPolicy{}, err
+		}
+		policy.Breached = ranges
+	}
+	return policy, nil
+}
+
 func HttpServer() {
-	godotenv.Load()
-	dbURL := os.Getenv("DB_URL")
-	db, err := sql.Open("postgres", dbURL)
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	logger, err := logging.New(os.Stdout, cfg.Log.Level)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// the standard log package now writes through slog as well
+	slog.SetDefault(logger)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing.Exporter, cfg.Tracing.SampleRatio)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+
+	db, err := sql.Open("postgres", cfg.DBURL)
 	if err != nil {
 		log.Fatalf("Failed to connect to the database: %v", err)
 	}
-	dbQueries := database.New(db)
+	migrations, err := migrate.NewProvider(db)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+	if cfg.MigrateOnStart {
+		results, err := migrations.Up(context.Background())
+		for _, res := range results {
+			log.Printf("Migration %s", res)
+		}
+		if err != nil {
+			log.Fatalf("Failed to apply migrations: %v", err)
+		}
+	}
+	dbQueries := database.New(tracing.WrapDB(db))
 
 	apiCfg := &apiConfig{
+		db:        db,
 		dbQueries: dbQueries,
-		PLATFORM:  os.Getenv("PLATFORM"),
-		JWTstring: os.Getenv("TOKEN"),
+		PLATFORM:  cfg.Platform,
+		jwtKeys:   hash.NewHMACKeySet(cfg.JWT.Secret, cfg.JWT.SecretKeyID),
+		metrics:   metrics.New(db),
+		polkaKey:  cfg.Polka.APIKey,
+		limits: content.Limits{
+			Standard:  cfg.Content.MaxLength,
+			ChirpyRed: cfg.Content.ChirpyRedMaxLength,
+			URLWeight: cfg.Content.URLWeight,
+		},
+	}
+	apiCfg.passwords, err = newPasswordHasher(cfg.Password)
+	if err != nil {
+		log.Fatalf("Failed to set up password hashing: %v", err)
+	}
+	apiCfg.pwpolicy, err = newPasswordPolicy(cfg.Password)
+	if err != nil {
+		log.Fatalf("Failed to load breached passwords: %v", err)
+	}
+	// without trusted proxies the peer may be a load balancer standing in
+	// for every client, and locking it out would lock out everyone
+	var ipPolicy throttle.Policy
+	if len(cfg.Server.TrustedProxies) > 0 {
+		ipPolicy = throttle.Policy{
+			MaxFailures: cfg.Login.IPMaxFailures,
+			Lockout:     cfg.Login.Lockout,
+			Window:      cfg.Login.FailureWindow,
+		}
+	} else {
+		log.Printf("Per-IP login lockout is off until TRUSTED_PROXIES is set")
+	}
+	apiCfg.logins = throttle.NewLogin(dbQueries,
+		throttle.Policy{
+			MaxFailures: cfg.Login.MaxFailures,
+			Lockout:     cfg.Login.Lockout,
+			BaseDelay:   cfg.Login.BaseDelay,
+			MaxDelay:    cfg.Login.MaxDelay,
+			Window:      cfg.Login.FailureWindow,
+		},
+		ipPolicy,
+	)
+	apiCfg.filter, err = content.NewFilter(cfg.Content.BannedWordsFile)
+	if err != nil {
+		log.Fatalf("Failed to load banned words: %v", err)
+	}
+	// asymmetric keys take over from the shared TOKEN secret once configured
+	if cfg.JWT.SigningKey != "" {
+		apiCfg.jwtKeys, err = hash.LoadKeySet(cfg.JWT.SigningKey, cfg.JWT.VerifyKeys)
+		if err != nil {
+			log.Fatalf("Failed to load JWT keys: %v", err)
+		}
+	}
+	apiCfg.jwtKeys.SetPolicy(hash.TokenPolicy{
+		Issuer:   cfg.JWT.Issuer,
+		Audience: cfg.JWT.Audience,
+		Leeway:   cfg.JWT.Leeway,
+	})
+	// authed wraps routes that need a valid access token, admin those that
+	// also need the admin role
+	authed := hash.Middleware(apiCfg.jwtKeys)
+	admin := func(next http.Handler) http.Handler {
+		return authed(hash.RequireRole(hash.RoleAdmin)(next))
 	}
+	// Prometheus authenticates with its own token when one is configured
+	scrape := admin
+	if cfg.Metrics.Token != "" {
+		scrape = hash.RequireToken(cfg.Metrics.Token)
+	}
+
+	checker := health.New(health.DefaultTimeout,
+		health.Ping(db),
+		health.MigrationVersion(db, migrate.Latest(migrations)),
+	)
+
+	var assets fs.FS = web.FS
+	if cfg.Static.Dir != "" {
+		assets = os.DirFS(cfg.Static.Dir)
+	}
+	var staticFiles http.Handler
+	if cfg.Static.Live {
+		log.Printf("Rereading %s on every request", cfg.Static.Dir)
+		staticFiles = static.Live(assets)
+	} else {
+		indexed, err := static.New(assets)
+		if err != nil {
+			log.Fatalf("Failed to load static assets: %v", err)
+		}
+		staticFiles = indexed
+	}
+
 	mux := http.NewServeMux()
+	// the client address is settled first, so every layer logs the same one
+	handler := response.TrustProxies(cfg.Server.TrustedPrefixes())(
+		requestid.Middleware(tracing.Middleware(logging.Middleware(logger)(apiCfg.metrics.Middleware(problem.Mux(mux))))))
 	server := http.Server{
-		Handler: mux,
-		Addr:    ":8080",
+		Handler:           handler,
+		Addr:              cfg.Server.Addr,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
 	}
 
-	mux.HandleFunc("GET /api/healthz", readinessHandler)                                                       // check status
-	mux.Handle("/app/", apiCfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir("."))))) // deliver files
-	mux.HandleFunc("GET /admin/metrics", apiCfg.metricsHandler)                                                // metics
-	mux.HandleFunc("POST /admin/reset", apiCfg.resetHandler)
+	mux.HandleFunc("GET /api/livez", checker.Livez)                // process is up
+	mux.HandleFunc("GET /api/readyz", checker.Readyz)              // dependencies are usable
+	mux.HandleFunc("GET /api/healthz", checker.Readyz)             // kept for existing probes
+	mux.Handle("GET /app/", http.StripPrefix("/app", staticFiles)) // deliver files
+	mux.Handle("GET /metrics", scrape(apiCfg.metrics.Handler()))   // prometheus scrape
+	mux.Handle("POST /admin/reset", admin(http.HandlerFunc(apiCfg.resetHandler)))
+	mux.Handle("PUT /admin/users/{id}/role", admin(http.HandlerFunc(apiCfg.setrole)))
+	mux.Handle("POST /admin/users/{id}/unlock", admin(http.HandlerFunc(apiCfg.unlockuser)))
+	mux.Handle("POST /admin/content/reload", admin(http.HandlerFunc(apiCfg.reloadcontent)))
+	mux.HandleFunc("GET /.well-known/jwks.json", apiCfg.jwksHandler) // public verification keys
 
 	// post chrip
-	mux.HandleFunc("POST /api/chirps", apiCfg.post)
-	// gets all
+	mux.Handle("POST /api/chirps", authed(http.HandlerFunc(apiCfg.post)))
+	// cleans and measures a chirp without posting it
+	mux.Handle("POST /api/chirps/validate", authed(http.HandlerFunc(apiCfg.validatechirp)))
+	// lists chirps, filtered by ?author_id= and paged by ?cursor=
 	mux.HandleFunc("GET /api/chirps", apiCfg.getchirps)
 	// gets chirp by id
 	mux.HandleFunc("GET /api/chirps/{id}", apiCfg.specchirps)
+	// deletes own chirp by id
+	mux.Handle("DELETE /api/chirps/{id}", authed(http.HandlerFunc(apiCfg.deletechirp)))
 	// api user, login reqs
 	mux.HandleFunc("POST /api/users", apiCfg.apiuser)
+	mux.Handle("PUT /api/users", authed(http.HandlerFunc(apiCfg.updateuser)))
 	mux.HandleFunc("POST /api/login", apiCfg.apilogin)
 	mux.HandleFunc("POST /api/refresh", apiCfg.apirefresh)
 	mux.HandleFunc("POST /api/revoke", apiCfg.apirevoke)
+	// payment provider events, authenticated with an ApiKey header
+	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.polkawebhook)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// SIGHUP rereads the banned word list without a restart
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go func() {
+		for range hup {
+			if err := apiCfg.filter.Reload(); err != nil {
+				log.Printf("Failed to reload banned words, keeping the old list: %v", err)
+				continue
+			}
+			log.Printf("Reloaded %d banned words", apiCfg.filter.Len())
+		}
+	}()
+
+	// failures from guessers that gave up would otherwise stay forever
+	go func() {
+		ticker := time.NewTicker(cfg.Login.FailureWindow)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if n, err := apiCfg.logins.Purge(ctx); err != nil {
+					log.Printf("Failed to purge login throttles: %v", err)
+				} else if n > 0 {
+					log.Printf("Purged %d expired login throttles", n)
+				}
+			}
+		}
+	}()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("Starting server on %s", cfg.Server.Addr)
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server failed to start: %v", err)
+		}
+	case <-ctx.Done():
+		log.Printf("Shutting down, draining requests for up to %s", cfg.Server.ShutdownTimeout)
+	}
 
-	log.Println("Starting server on :8080")
-	if err := server.ListenAndServe(); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+	// fail readiness first and keep serving for a moment so load
+	// balancers notice before the listener goes away
+	checker.SetDraining()
+	if cfg.Server.DrainDelay > 0 {
+		log.Printf("Reporting not ready for %s before shutdown", cfg.Server.DrainDelay)
+		time.Sleep(cfg.Server.DrainDelay)
 	}
+
+	// stop accepting connections and let in-flight requests finish
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server shutdown incomplete: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		log.Printf("Failed to close the database: %v", err)
+	}
+	// flush spans still sitting in the batcher
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
+	log.Println("Server stopped")
+}
+
+// migrateCommand implements "httpserv migrate <command> [flags]". It reads
+// the same config as the server so DB_URL comes from the same place.
+func migrateCommand(args []string) {
+	if len(args) == 0 {
+		log.Fatalf("usage: httpserv migrate %s [flags]", migrate.Commands)
+	}
+	cfg, err := config.LoadDB(args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := sql.Open("postgres", cfg.DBURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to the database: %v", err)
+	}
+	defer db.Close()
+	migrations, err := migrate.NewProvider(db)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := migrate.Run(ctx, migrations, args[0], os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// grantRoleCommand implements "httpserv grant-role <email> <role> [flags]".
+// It is how the first admin gets created: register normally through
+// POST /api/users, then promote the account from a shell that can reach the
+// database. Later changes can go through PUT /admin/users/{id}/role.
+func grantRoleCommand(args []string) {
+	if len(args) < 2 {
+		log.Fatal("usage: httpserv grant-role <email> <user|moderator|admin> [flags]")
+	}
+	role, ok := hash.ParseRole(args[1])
+	if !ok {
+		log.Fatalf("unknown role %q, want user, moderator or admin", args[1])
+	}
+	cfg, err := config.LoadDB(args[2:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := sql.Open("postgres", cfg.DBURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to the database: %v", err)
+	}
+	defer db.Close()
+
+	user, err := database.New(db).SetUserRoleByEmail(context.Background(), database.SetUserRoleByEmailParams{
+		Email: args[0],
+		Role:  string(role),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Fatalf("no user with email %q", args[0])
+	}
+	if err != nil {
+		log.Fatalf("Failed to set role: %v", err)
+	}
+	log.Printf("%s (%s) is now %s; it applies to access tokens issued from now on", user.Email, user.ID, user.Role)
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			migrateCommand(os.Args[2:])
+			return
+		case "grant-role":
+			grantRoleCommand(os.Args[2:])
+			return
+		}
+	}
 	HttpServer()
 }
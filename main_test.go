@@ -0,0 +1,384 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	hash "httpserv/internal/auth"
+	"httpserv/internal/database"
+	"httpserv/internal/metrics"
+	"httpserv/internal/requestid"
+	"httpserv/internal/throttle"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TestChirpCursorMustMatchQuery checks that a cursor is only accepted
+// with the sort and author_id of the page that issued it.
+func TestChirpCursorMustMatchQuery(t *testing.T) {
+	author := uuid.NullUUID{UUID: uuid.New(), Valid: true}
+	cursor := encodeCursor(chirpCursor{Sort: "desc", AuthorID: author, CreatedAt: time.Now(), ID: uuid.New()})
+
+	got, err := decodeCursor(cursor)
+	if err != nil || got.Sort != "desc" || got.AuthorID != author {
+		t.Fatalf("decodeCursor = %+v, %v", got, err)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"other sort", "sort=asc&author_id=" + author.UUID.String()},
+		{"default sort", "author_id=" + author.UUID.String()},
+		{"other author", "sort=desc&author_id=" + uuid.NewString()},
+		{"no author", "sort=desc"},
+	}
+	cfg := &apiConfig{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/chirps?"+tt.query+"&cursor="+cursor, nil)
+			w := httptest.NewRecorder()
+			cfg.getchirps(w, r)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+// TestLoginUnknownEmailMatchesWrongPassword checks that a login for an
+// email nobody registered can't be told apart from a wrong password for a
+// real account, whichever scheme that account's hash uses, or if it holds
+// no usable hash at all.
+func TestLoginUnknownEmailMatchesWrongPassword(t *testing.T) {
+	argon2id := hash.NewArgon2id(hash.Argon2Params{Memory: 64, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32})
+	bcryptScheme := hash.NewBcrypt(bcrypt.MinCost)
+
+	stored := map[string]string{
+		// the schema default for accounts that never set a password
+		"unset": "unset",
+	}
+	for _, scheme := range []hash.PasswordScheme{argon2id, bcryptScheme} {
+		encoded, err := scheme.Hash("correct-horse-battery")
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored[scheme.Name()] = encoded
+	}
+
+	for name, encoded := range stored {
+		t.Run(name, func(t *testing.T) {
+			db := newFakeDB(database.User{
+				ID:             uuid.New(),
+				CreatedAt:      time.Now(),
+				UpdatedAt:      time.Now(),
+				Email:          "saul@bettercall.com",
+				HashedPassword: encoded,
+				Role:           string(hash.RoleUser),
+			})
+			cfg := newLoginTestConfig(t, db, argon2id, bcryptScheme)
+
+			unknown := login(t, cfg, "nobody@bettercall.com", "correct-horse-battery")
+			wrong := login(t, cfg, "saul@bettercall.com", "wrong-horse-battery")
+
+			if unknown.status != http.StatusUnauthorized {
+				t.Errorf("unknown email: status = %d, want %d", unknown.status, http.StatusUnauthorized)
+			}
+			if unknown.status != wrong.status {
+				t.Errorf("status: unknown email %d, wrong password %d", unknown.status, wrong.status)
+			}
+			for _, h := range []string{"Content-Type", "WWW-Authenticate", "Retry-After"} {
+				if u, w := unknown.header.Get(h), wrong.header.Get(h); u != w {
+					t.Errorf("%s: unknown email %q, wrong password %q", h, u, w)
+				}
+			}
+			if unknown.body != wrong.body {
+				t.Errorf("body:\n unknown email  %s\n wrong password %s", unknown.body, wrong.body)
+			}
+		})
+	}
+}
+
+// TestLoginConcurrentGuessesAreThrottled sends more wrong passwords at
+// once than the account allows and checks that the rest are refused
+// before their password is checked, rather than all passing the throttle
+// before the first failure is recorded.
+func TestLoginConcurrentGuessesAreThrottled(t *testing.T) {
+	argon2id := hash.NewArgon2id(hash.Argon2Params{Memory: 64, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32})
+	encoded, err := argon2id.Hash("correct-horse-battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := newFakeDB(database.User{ID: uuid.New(), Email: "saul@bettercall.com", HashedPassword: encoded})
+	cfg := newLoginTestConfig(t, db, argon2id)
+
+	const attempts = 20
+	statuses := make(chan int, attempts)
+	var wg sync.WaitGroup
+	for i := range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"email":"saul@bettercall.com","password":"guess-%d"}`, i)
+			req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(body))
+			rec := httptest.NewRecorder()
+			cfg.apilogin(rec, req)
+			statuses <- rec.Code
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	counts := make(map[int]int)
+	for status := range statuses {
+		counts[status]++
+	}
+	if counts[http.StatusUnauthorized]+counts[http.StatusTooManyRequests] != attempts {
+		t.Fatalf("statuses = %v, want only 401 and 429", counts)
+	}
+	if checked := counts[http.StatusUnauthorized]; checked > 5 {
+		t.Errorf("%d attempts reached the password check, want at most MaxFailures (5)", checked)
+	}
+}
+
+// TestLoginRehashesOutdatedPassword logs in with a bcrypt hash while
+// argon2id is current and checks the stored hash is replaced by one that
+// still accepts the same password.
+func TestLoginRehashesOutdatedPassword(t *testing.T) {
+	argon2id := hash.NewArgon2id(hash.Argon2Params{Memory: 64, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32})
+	bcryptScheme := hash.NewBcrypt(bcrypt.MinCost)
+	legacy, err := bcryptScheme.Hash("correct-horse-battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := newFakeDB(database.User{ID: uuid.New(), Email: "saul@bettercall.com", HashedPassword: legacy, Role: string(hash.RoleUser)})
+	cfg := newLoginTestConfig(t, db, argon2id, bcryptScheme)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/login",
+		strings.NewReader(`{"email":"saul@bettercall.com","password":"correct-horse-battery"}`))
+	rec := httptest.NewRecorder()
+	cfg.apilogin(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d; body %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	user, err := cfg.dbQueries.GetPwByEmail(context.Background(), "saul@bettercall.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !argon2id.Owns(user.HashedPassword) {
+		t.Fatalf("stored hash = %q, want it rehashed with argon2id", user.HashedPassword)
+	}
+	if cfg.passwords.NeedsRehash(user.HashedPassword) {
+		t.Error("rehashed password still needs a rehash")
+	}
+	if err := cfg.passwords.Check(context.Background(), "correct-horse-battery", user.HashedPassword); err != nil {
+		t.Errorf("rehashed password doesn't verify: %v", err)
+	}
+}
+
+type loginResult struct {
+	status int
+	header http.Header
+	body   string // with request_id removed
+}
+
+func login(t *testing.T, cfg *apiConfig, email, password string) loginResult {
+	t.Helper()
+	body := fmt.Sprintf(`{"email":%q,"password":%q}`, email, password)
+	req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(body))
+	req.RemoteAddr = "203.0.113.7:51234"
+	rec := httptest.NewRecorder()
+	requestid.Middleware(http.HandlerFunc(cfg.apilogin)).ServeHTTP(rec, req)
+
+	// every response carries its own request ID; nothing else may differ
+	var problem map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("response body %q: %v", rec.Body.String(), err)
+	}
+	delete(problem, "request_id")
+	normalized, err := json.Marshal(problem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loginResult{status: rec.Code, header: rec.Header(), body: string(normalized)}
+}
+
+func newLoginTestConfig(t *testing.T, db *sql.DB, current hash.PasswordScheme, others ...hash.PasswordScheme) *apiConfig {
+	t.Helper()
+	passwords, err := hash.NewPasswordHasher(current, others...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queries := database.New(db)
+	return &apiConfig{
+		db:        db,
+		dbQueries: queries,
+		jwtKeys:   hash.NewHMACKeySet("0123456789abcdef0123456789abcdef", "test"),
+		metrics:   metrics.New(db),
+		passwords: passwords,
+		logins: throttle.NewLogin(queries,
+			throttle.Policy{MaxFailures: 5, Lockout: time.Minute, BaseDelay: time.Second, MaxDelay: time.Minute, Window: time.Minute},
+			throttle.Policy{MaxFailures: 100, Lockout: time.Minute, Window: time.Minute},
+		),
+	}
+}
+
+// fakeDB is a database/sql driver that answers the queries the login
+// handler makes from memory, so the handler runs against a real *sql.DB
+// without Postgres. Any other query fails.
+type fakeDB struct {
+	mu        sync.Mutex
+	users     map[string]database.User
+	throttles map[string]database.LoginThrottle
+}
+
+func newFakeDB(users ...database.User) *sql.DB {
+	f := &fakeDB{
+		users:     make(map[string]database.User),
+		throttles: make(map[string]database.LoginThrottle),
+	}
+	for _, u := range users {
+		f.users[u.Email] = u
+	}
+	return sql.OpenDB(f)
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) { return fakeConn{f}, nil }
+func (f *fakeDB) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ db *fakeDB }
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("fakeDB: prepared statements are not supported")
+}
+func (c fakeConn) Close() error { return nil }
+func (c fakeConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("fakeDB: transactions are not supported")
+}
+
+var throttleColumns = []string{"key", "failures", "last_failure_at", "locked_until"}
+
+func (c fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	f := c.db
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch queryName(query) {
+	case "GetPwByEmail":
+		rows := &fakeRows{columns: []string{"id", "created_at", "updated_at", "email", "hashed_password", "role", "is_chirpy_red"}}
+		if u, ok := f.users[args[0].Value.(string)]; ok {
+			rows.values = append(rows.values, []driver.Value{u.ID.String(), u.CreatedAt, u.UpdatedAt, u.Email, u.HashedPassword, u.Role, u.IsChirpyRed})
+		}
+		return rows, nil
+	case "ReserveLoginAttempt":
+		key := args[0].Value.(string)
+		now := args[1].Value.(time.Time)
+		windowStart := args[2].Value.(time.Time)
+		row, ok := f.throttles[key]
+		switch {
+		case !ok:
+			row = database.LoginThrottle{Key: key, Failures: 1, LastFailureAt: now}
+		case row.LockedUntil.Valid && row.LockedUntil.Time.After(now):
+		case row.LastFailureAt.Before(windowStart):
+			row.Failures, row.LastFailureAt = 1, now
+		default:
+			row.Failures, row.LastFailureAt = row.Failures+1, now
+		}
+		f.throttles[key] = row
+		return &fakeRows{columns: throttleColumns, values: [][]driver.Value{throttleValues(row)}}, nil
+	case "NewRToken":
+		now := time.Now()
+		return &fakeRows{
+			columns: []string{"token_hash", "created_at", "updated_at", "user_id", "expires_at", "revoked_at", "family_id", "replaced_by"},
+			values:  [][]driver.Value{{args[0].Value, now, now, args[1].Value, args[2].Value, nil, args[3].Value, nil}},
+		}, nil
+	}
+	return nil, fmt.Errorf("fakeDB: unexpected query %q", queryName(query))
+}
+
+func (c fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	f := c.db
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch queryName(query) {
+	case "LockLogin":
+		key := args[0].Value.(string)
+		row := f.throttles[key]
+		if t, ok := args[1].Value.(time.Time); ok {
+			row.LockedUntil = sql.NullTime{Time: t, Valid: true}
+		}
+		f.throttles[key] = row
+		return driver.RowsAffected(1), nil
+	case "RehashPassword":
+		newHash, id, oldHash := args[0].Value.(string), args[1].Value.(string), args[2].Value.(string)
+		for email, u := range f.users {
+			if u.ID.String() == id && u.HashedPassword == oldHash {
+				u.HashedPassword = newHash
+				f.users[email] = u
+				return driver.RowsAffected(1), nil
+			}
+		}
+		return driver.RowsAffected(0), nil
+	case "RefundLoginAttempt":
+		maxFailures := args[0].Value.(int64)
+		key := args[1].Value.(string)
+		if row, ok := f.throttles[key]; ok {
+			if int64(row.Failures)-1 < maxFailures {
+				row.LockedUntil = sql.NullTime{}
+			}
+			row.Failures = max(row.Failures-1, 0)
+			f.throttles[key] = row
+		}
+		return driver.RowsAffected(1), nil
+	case "ClearLoginThrottle":
+		delete(f.throttles, args[0].Value.(string))
+		return driver.RowsAffected(1), nil
+	}
+	return nil, fmt.Errorf("fakeDB: unexpected statement %q", queryName(query))
+}
+
+// queryName pulls the sqlc query name out of its "-- name: X :kind" line.
+func queryName(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) < 3 || fields[0] != "--" || fields[1] != "name:" {
+		return query
+	}
+	return fields[2]
+}
+
+func throttleValues(row database.LoginThrottle) []driver.Value {
+	var lockedUntil driver.Value
+	if row.LockedUntil.Valid {
+		lockedUntil = row.LockedUntil.Time
+	}
+	return []driver.Value{row.Key, int64(row.Failures), row.LastFailureAt, lockedUntil}
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
@@ -0,0 +1,7 @@
+-- name: SetChirpyRed :execrows
+-- updated_at only moves when the flag actually changes, so replayed
+-- webhook deliveries leave the row untouched
+UPDATE users
+SET is_chirpy_red = $2,
+    updated_at = CASE WHEN is_chirpy_red = $2 THEN updated_at ELSE NOW() END
+WHERE id = $1;
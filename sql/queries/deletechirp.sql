@@ -0,0 +1,2 @@
+-- name: DeleteChirp :exec
+DELETE FROM posts WHERE id = $1;
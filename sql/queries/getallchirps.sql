@@ -1,4 +0,0 @@
--- name: GetAllChirps :many
-SELECT * 
-FROM posts 
-ORDER BY created_at ASC;
\ No newline at end of file
@@ -0,0 +1,42 @@
+-- name: ReserveLoginAttempt :one
+-- counts an attempt before the password is checked, so concurrent guesses
+-- each see the ones before them. A locked key is returned unchanged; a
+-- first attempt after a quiet period starts the count over.
+INSERT INTO login_throttle (key, failures, last_failure_at)
+VALUES (sqlc.arg('key'), 1, sqlc.arg('now'))
+ON CONFLICT (key) DO UPDATE
+SET failures = CASE
+        WHEN login_throttle.locked_until > sqlc.arg('now') THEN login_throttle.failures
+        WHEN login_throttle.last_failure_at < sqlc.arg('window_start') THEN 1
+        ELSE login_throttle.failures + 1
+    END,
+    last_failure_at = CASE
+        WHEN login_throttle.locked_until > sqlc.arg('now') THEN login_throttle.last_failure_at
+        ELSE sqlc.arg('now')
+    END
+RETURNING *;
+
+-- name: LockLogin :exec
+UPDATE login_throttle
+SET locked_until = $2
+WHERE key = $1;
+
+-- name: RefundLoginAttempt :exec
+-- hands back an attempt that turned out to be a success, lifting the lock
+-- if that takes the count back under the limit
+UPDATE login_throttle
+SET failures = GREATEST(failures - 1, 0),
+    locked_until = CASE
+        WHEN failures - 1 < sqlc.arg('max_failures')::int THEN NULL
+        ELSE locked_until
+    END
+WHERE key = sqlc.arg('key');
+
+-- name: ClearLoginThrottle :exec
+DELETE FROM login_throttle WHERE key = $1;
+
+-- name: PurgeLoginThrottles :execrows
+-- rows whose window has passed and that aren't locked count for nothing
+DELETE FROM login_throttle
+WHERE last_failure_at < sqlc.arg('window_start')
+    AND (locked_until IS NULL OR locked_until < sqlc.arg('now')::timestamp);
@@ -1,4 +1,4 @@
 -- name: NewRToken :one
-INSERT INTO refresh_tokens (token, user_id, expires_at)
-VALUES ($1, $2, $3)
-RETURNING *;
\ No newline at end of file
+INSERT INTO refresh_tokens (token_hash, user_id, expires_at, family_id)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
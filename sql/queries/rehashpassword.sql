@@ -0,0 +1,6 @@
+-- name: RehashPassword :execrows
+-- only replaces the hash that was verified, so a password change made in
+-- the meantime is never overwritten
+UPDATE users
+SET hashed_password = sqlc.arg('new_hash')
+WHERE id = sqlc.arg('id') AND hashed_password = sqlc.arg('old_hash');
@@ -1,4 +1,9 @@
 -- name: RevokeRToken :exec
 UPDATE refresh_tokens
 SET revoked_at = $2, updated_at = $3
-WHERE token = $1;
+WHERE token_hash = $1;
+
+-- name: RevokeAllUserRTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
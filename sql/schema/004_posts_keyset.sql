@@ -0,0 +1,7 @@
+-- +goose Up
+CREATE INDEX idx_posts_created_at_id ON posts (created_at, id);
+CREATE INDEX idx_posts_user_id_created_at_id ON posts (user_id, created_at, id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_posts_user_id_created_at_id;
+DROP INDEX IF EXISTS idx_posts_created_at_id;
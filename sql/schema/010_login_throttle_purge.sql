@@ -0,0 +1,9 @@
+-- +goose Up
+-- account keys are now a hash of the email; rows keyed by the raw email
+-- would never be looked up again
+DELETE FROM login_throttle WHERE key LIKE 'account:%';
+CREATE INDEX login_throttle_last_failure_at_idx ON login_throttle (last_failure_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS login_throttle_last_failure_at_idx;
+DELETE FROM login_throttle WHERE key LIKE 'account:%';
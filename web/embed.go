@@ -0,0 +1,7 @@
+// Package web embeds the static site served under /app/.
+package web
+
+import "embed"
+
+//go:embed index.html assets
+var FS embed.FS